@@ -0,0 +1,35 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"reflect"
+	"sync"
+)
+
+// tokenizedTypes holds the *tokenized for the struct types passed to
+// NewTypeSQLMarshaller keyed by their reflect.Type, they are never
+// modified once tokenized so all the marshallers for a type share it.
+var tokenizedTypes sync.Map
+
+// cachedTokenizeType is TokenizeType for a type named after itself, it is
+// tokenized only the first time and safe for concurrent use.
+func cachedTokenizeType(t reflect.Type) (*tokenized, error) {
+	if tokens, ok := tokenizedTypes.Load(t); ok {
+		return tokens.(*tokenized), nil
+	}
+	tokens, err := TokenizeType(t, t.Name())
+	if err != nil {
+		return nil, err
+	}
+	// another goroutine might have tokenized it meanwhile.
+	shared, _ := tokenizedTypes.LoadOrStore(t, tokens)
+	return shared.(*tokenized), nil
+}
+
+// For returns a marshaller for the struct type T, see NewTypeSQLMarshaller,
+// the type is tokenized only once and the marshallers share it.
+func For[T any]() (*SQLMarshaller, error) {
+	var zero T
+	return NewTypeSQLMarshaller(zero, "")
+}
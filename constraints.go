@@ -0,0 +1,78 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+)
+
+// ConstraintKind is the kind of a table constraint.
+type ConstraintKind string
+
+const (
+	ConstraintPK     ConstraintKind = "pk"
+	ConstraintFK     ConstraintKind = "fk"
+	ConstraintUnique ConstraintKind = "uq"
+	ConstraintCheck  ConstraintKind = "ck"
+)
+
+// ConstraintNamer returns the name for a constraint of the passed kind
+// over the given columns of a table.
+type ConstraintNamer func(kind ConstraintKind, table string, columns []string) string
+
+// DefaultConstraintNamer names constraints <kind>_<table>_<columns> with
+// the columns joined by underscores, except primary keys which are
+// named pk_<table> since there is only one per table.
+func DefaultConstraintNamer(kind ConstraintKind, table string, columns []string) string {
+	if kind == ConstraintPK {
+		return fmt.Sprintf("%s_%s", kind, table)
+	}
+	return fmt.Sprintf("%s_%s_%s", kind, table, strings.Join(columns, "_"))
+}
+
+// hashLength is the amount of hex characters of the hash appended
+// to truncated identifiers.
+const hashLength = 8
+
+// truncateIdentifier shortens the passed identifier to at most max
+// characters replacing the excess by a hash of the whole identifier
+// so truncated names that share a prefix do not collide.
+// A max of 0 means there is no limit.
+func truncateIdentifier(identifier string, max int) string {
+	if max <= 0 || len(identifier) <= max {
+		return identifier
+	}
+	h := fnv.New32a()
+	h.Write([]byte(identifier))
+	hash := fmt.Sprintf("%08x", h.Sum32())
+	if max <= hashLength {
+		return hash[:max]
+	}
+	return fmt.Sprintf("%s_%s", identifier[:max-hashLength-1], hash)
+}
+
+// nameConstraints fills the empty constraint names in the passed table
+// using namer.
+func nameConstraints(table *TableDefinition, namer ConstraintNamer) {
+	if table.PKName == "" && len(table.PKs) != 0 {
+		table.PKName = namer(ConstraintPK, table.Name, table.PKs)
+	}
+	for i := range table.FKs {
+		if table.FKs[i].Name == "" {
+			table.FKs[i].Name = namer(ConstraintFK, table.Name, table.FKs[i].Names)
+		}
+	}
+	for i := range table.Uniques {
+		if table.Uniques[i].Name == "" {
+			table.Uniques[i].Name = namer(ConstraintUnique, table.Name, table.Uniques[i].Columns)
+		}
+	}
+	for i := range table.Fields {
+		f := &table.Fields[i]
+		if f.Check != "" && f.CheckName == "" {
+			f.CheckName = namer(ConstraintCheck, table.Name, []string{f.Name})
+		}
+	}
+}
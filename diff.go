@@ -0,0 +1,444 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AlterKind is the kind of a change made to a schema.
+type AlterKind string
+
+const (
+	AlterAddColumn      AlterKind = "add column"
+	AlterDropColumn     AlterKind = "drop column"
+	AlterRenameColumn   AlterKind = "rename column"
+	AlterColumnType     AlterKind = "alter column type"
+	AlterSetDefault     AlterKind = "set default"
+	AlterDropDefault    AlterKind = "drop default"
+	AlterAddConstraint  AlterKind = "add constraint"
+	AlterDropConstraint AlterKind = "drop constraint"
+	AlterDropIndex      AlterKind = "drop index"
+
+	// changes that are not rendered by DefineAlter.
+	AlterCreateTable AlterKind = "create table"
+	AlterDropTable   AlterKind = "drop table"
+	AlterCreateIndex AlterKind = "create index"
+	AlterComment     AlterKind = "comment"
+)
+
+// AlterDefinition describes a change to a table.
+type AlterDefinition struct {
+	Kind  AlterKind
+	Table string
+	// Name is the name of the column, constraint or index changed.
+	Name string
+	// OldName is the previous name of a renamed column.
+	OldName string
+	// Definition is the column for AlterAddColumn, the type for
+	// AlterColumnType, the DEFAULT clause for AlterSetDefault, the
+	// named constraint for AlterAddConstraint and the comment for
+	// AlterComment.
+	Definition string
+
+	// The definitions the change is made from, so it can be applied
+	// to them without parsing statements.
+
+	// Field is the column as it is after the change for the changes
+	// to columns.
+	Field FieldDefinition
+	// Constraint holds, as its only constraint, the constraint added
+	// by AlterAddConstraint.
+	Constraint TableDefinition
+	// Created is the table created by AlterCreateTable.
+	Created TableDefinition
+	// Index is the index created by AlterCreateIndex.
+	Index IndexDefinition
+}
+
+// Change is a statement migrating a schema.
+type Change struct {
+	Kind      AlterKind
+	Table     string
+	Statement string
+	// Destructive changes might lose data, such as dropping a
+	// table or a column or changing the type of the latter.
+	Destructive bool
+}
+
+// namedConstraint is a constraint of a table with its definition as
+// rendered by a driver, which is what tells if it changed, and a table
+// holding only that constraint.
+type namedConstraint struct {
+	name       string
+	definition string
+	only       TableDefinition
+}
+
+// constraintsOf returns all the constraints of the passed table.
+func constraintsOf(d SQLDriver, table TableDefinition) []namedConstraint {
+	constraints := []namedConstraint{}
+	if pk, ok := d.DefinePK(table.PKs); ok {
+		only := TableDefinition{PKs: table.PKs, PKName: table.PKName}
+		constraints = append(constraints, namedConstraint{table.PKName, pk, only})
+	}
+	for _, fk := range table.FKs {
+		only := TableDefinition{FKs: []FKDefinition{fk}}
+		constraints = append(constraints, namedConstraint{fk.Name, d.DefineFK(qualifiedFK(table.Options.Schema, fk)), only})
+	}
+	for _, u := range table.Uniques {
+		only := TableDefinition{Uniques: []UniqueDefinition{u}}
+		constraints = append(constraints, namedConstraint{u.Name, d.DefineUnique(u.Columns), only})
+	}
+	for _, f := range table.Fields {
+		if f.Check != "" {
+			only := TableDefinition{Fields: []FieldDefinition{{Name: f.Name, Check: f.Check, CheckName: f.CheckName}}}
+			constraints = append(constraints, namedConstraint{f.CheckName, d.DefineCheck(f.Check), only})
+		}
+	}
+	return constraints
+}
+
+// sameConstraint returns true if there is a constraint in constraints with
+// the same name and definition as c, unnamed constraints, such as the ones
+// read from databases that do not keep their names, match any name.
+// Unquoted identifiers are case insensitive.
+func sameConstraint(constraints []namedConstraint, c namedConstraint) bool {
+	for _, other := range constraints {
+		sameName := c.name == "" || other.name == "" || strings.EqualFold(other.name, c.name)
+		if sameName && strings.EqualFold(other.definition, c.definition) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameIndex returns true if there is an index in indexes with the same
+// name and definition as index.
+func sameIndex(d SQLDriver, indexes []IndexDefinition, index IndexDefinition) bool {
+	for _, other := range indexes {
+		if strings.EqualFold(defineIndex(d, other), defineIndex(d, index)) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableDiff accumulates the changes to a table and the definitions of
+// each of them.
+type tableDiff struct {
+	d       SQLDriver
+	table   string
+	changes []Change
+	alters  []AlterDefinition
+}
+
+// alter adds the statement for the passed change.
+func (t *tableDiff) alter(alter AlterDefinition, destructive bool) error {
+	alter.Table = t.table
+	statement, err := t.d.DefineAlter(alter)
+	if err != nil {
+		return fmt.Errorf("altering %q: %w", t.table, err)
+	}
+	t.add(alter, statement, destructive)
+	return nil
+}
+
+// comment adds the statement setting the comment of the table, or of one of
+// its columns if column is not empty, comments are left out for dialects
+// that have none.
+func (t *tableDiff) comment(column, comment string) error {
+	statement, err := t.d.DefineComment(t.table, column, comment)
+	if errors.Is(err, ErrNoComments) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("commenting %q: %w", t.table, err)
+	}
+	t.add(AlterDefinition{Kind: AlterComment, Name: column, Definition: comment}, statement, false)
+	return nil
+}
+
+// add adds the passed statement for the passed change.
+func (t *tableDiff) add(alter AlterDefinition, statement string, destructive bool) {
+	alter.Table = t.table
+	t.changes = append(t.changes, Change{
+		Kind:        alter.Kind,
+		Table:       t.table,
+		Statement:   statement,
+		Destructive: destructive,
+	})
+	t.alters = append(t.alters, alter)
+}
+
+// DiffTables returns the changes that turn the old definition of a table
+// into the new one. Constraints and indexes that changed are dropped first,
+// then columns are renamed, added, altered and dropped, and finally the new
+// constraints and indexes are added.
+// Columns are matched by name, regardless of its case, or, if renamed, by
+// their RenamedFrom.
+func DiffTables(d SQLDriver, old, new TableDefinition) ([]Change, error) {
+	diff, err := diffTables(d, old, new)
+	if err != nil {
+		return nil, err
+	}
+	return diff.changes, nil
+}
+
+// diffTables is like DiffTables but returns the diff, which also holds the
+// definition of each change.
+func diffTables(d SQLDriver, old, new TableDefinition) (*tableDiff, error) {
+	diff := &tableDiff{d: d, table: qualifiedName(new.Options.Schema, new.Name)}
+
+	oldFields := map[string]FieldDefinition{}
+	for _, f := range old.Fields {
+		oldFields[strings.ToLower(f.Name)] = f
+	}
+	newNames := map[string]bool{}
+	for _, f := range new.Fields {
+		newNames[strings.ToLower(f.Name)] = true
+	}
+	// previous holds the old name of the new columns that already
+	// existed and kept the old names that are still in use, both
+	// in lower case.
+	previous := map[string]string{}
+	kept := map[string]bool{}
+	for _, f := range new.Fields {
+		name := strings.ToLower(f.Name)
+		from := name
+		if _, ok := oldFields[from]; !ok {
+			from = strings.ToLower(f.RenamedFrom)
+		}
+		if _, ok := oldFields[from]; !ok || (from != name && newNames[from]) {
+			continue
+		}
+		previous[name] = from
+		kept[from] = true
+	}
+
+	oldConstraints, newConstraints := constraintsOf(d, old), constraintsOf(d, new)
+	for _, c := range oldConstraints {
+		if sameConstraint(newConstraints, c) {
+			continue
+		}
+		if c.name == "" {
+			return nil, fmt.Errorf("altering %q: cannot drop the unnamed constraint %q", diff.table, c.definition)
+		}
+		name := truncateIdentifier(c.name, d.MaxIdentifierLength())
+		if err := diff.alter(AlterDefinition{Kind: AlterDropConstraint, Name: name}, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, idx := range old.Indexes {
+		if sameIndex(d, new.Indexes, idx) {
+			continue
+		}
+		name := qualifiedName(old.Options.Schema, truncateIdentifier(idx.Name, d.MaxIdentifierLength()))
+		if err := diff.alter(AlterDefinition{Kind: AlterDropIndex, Name: name}, false); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, f := range new.Fields {
+		if from, ok := previous[strings.ToLower(f.Name)]; ok && from != strings.ToLower(f.Name) {
+			alter := AlterDefinition{Kind: AlterRenameColumn, Name: f.Name, OldName: oldFields[from].Name}
+			if err := diff.alter(alter, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, f := range new.Fields {
+		from, ok := previous[strings.ToLower(f.Name)]
+		if !ok {
+			definition, err := columnDefinition(d, f)
+			if err != nil {
+				return nil, err
+			}
+			alter := AlterDefinition{Kind: AlterAddColumn, Name: f.Name, Definition: definition, Field: f}
+			if err := diff.alter(alter, false); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		o := oldFields[from]
+		if o.Type != f.Type || o.Size != f.Size {
+			definition, err := typeDefinition(d, f)
+			if err != nil {
+				return nil, err
+			}
+			alter := AlterDefinition{
+				Kind:       AlterColumnType,
+				Name:       f.Name,
+				Definition: strings.TrimPrefix(definition, f.Name+" "),
+				Field:      f,
+			}
+			if err := diff.alter(alter, true); err != nil {
+				return nil, err
+			}
+		}
+		if o.Default != f.Default {
+			alter := AlterDefinition{Kind: AlterDropDefault, Name: f.Name, Field: f}
+			if f.Default != "" {
+				alter = AlterDefinition{Kind: AlterSetDefault, Name: f.Name, Definition: d.DefineDefault(f.Default), Field: f}
+			}
+			if err := diff.alter(alter, false); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for _, f := range old.Fields {
+		if kept[strings.ToLower(f.Name)] {
+			continue
+		}
+		if err := diff.alter(AlterDefinition{Kind: AlterDropColumn, Name: f.Name}, true); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, c := range newConstraints {
+		if sameConstraint(oldConstraints, c) {
+			continue
+		}
+		alter := AlterDefinition{Kind: AlterAddConstraint, Name: c.name, Definition: constraint(d, c.name, c.definition), Constraint: c.only}
+		if err := diff.alter(alter, false); err != nil {
+			return nil, err
+		}
+	}
+	for _, idx := range new.Indexes {
+		if !sameIndex(d, old.Indexes, idx) {
+			qualified := idx
+			qualified.Table = qualifiedName(new.Options.Schema, idx.Table)
+			diff.add(AlterDefinition{Kind: AlterCreateIndex, Name: idx.Name, Index: idx}, defineIndex(d, qualified), false)
+		}
+	}
+
+	if old.Options.Comment != new.Options.Comment {
+		if err := diff.comment("", new.Options.Comment); err != nil {
+			return nil, err
+		}
+	}
+	for _, f := range new.Fields {
+		var before string
+		if from, ok := previous[strings.ToLower(f.Name)]; ok {
+			before = oldFields[from].Comment
+		}
+		if before == f.Comment {
+			continue
+		}
+		if err := diff.comment(f.Name, f.Comment); err != nil {
+			return nil, err
+		}
+	}
+	return diff, nil
+}
+
+// DiffSchemas returns the changes that turn the old definitions of the
+// tables of a schema into the new ones, both sorted so tables come after
+// the ones they reference. The new tables are created first, then the
+// ones in both are altered and finally the ones removed are dropped.
+func DiffSchemas(d SQLDriver, old, new []TableDefinition) ([]Change, error) {
+	changes, _, err := diffSchemas(d, old, new)
+	return changes, err
+}
+
+// diffSchemas is like DiffSchemas but also returns the definition of each
+// change.
+func diffSchemas(d SQLDriver, old, new []TableDefinition) ([]Change, []AlterDefinition, error) {
+	oldTables := map[string]TableDefinition{}
+	for _, t := range old {
+		oldTables[strings.ToLower(t.Name)] = t
+	}
+	newTables := map[string]bool{}
+	creates, alters := &tableDiff{}, &tableDiff{}
+	for _, t := range new {
+		newTables[strings.ToLower(t.Name)] = true
+		if o, ok := oldTables[strings.ToLower(t.Name)]; ok {
+			diff, err := diffTables(d, o, t)
+			if err != nil {
+				return nil, nil, err
+			}
+			alters.changes = append(alters.changes, diff.changes...)
+			alters.alters = append(alters.alters, diff.alters...)
+			continue
+		}
+		diff := &tableDiff{d: d, table: qualifiedName(t.Options.Schema, t.Name)}
+		create, err := CraftCreate(d, t)
+		if err != nil {
+			return nil, nil, err
+		}
+		diff.add(AlterDefinition{Kind: AlterCreateTable, Name: t.Name, Created: t}, create, false)
+		for _, idx := range t.Indexes {
+			qualified := idx
+			qualified.Table = qualifiedName(t.Options.Schema, idx.Table)
+			diff.add(AlterDefinition{Kind: AlterCreateIndex, Name: idx.Name, Index: idx}, defineIndex(d, qualified), false)
+		}
+		if t.Options.Comment != "" {
+			if err := diff.comment("", t.Options.Comment); err != nil {
+				return nil, nil, err
+			}
+		}
+		for _, f := range t.Fields {
+			if f.Comment == "" {
+				continue
+			}
+			if err := diff.comment(f.Name, f.Comment); err != nil {
+				return nil, nil, err
+			}
+		}
+		creates.changes = append(creates.changes, diff.changes...)
+		creates.alters = append(creates.alters, diff.alters...)
+	}
+	changes := append(creates.changes, alters.changes...)
+	definitions := append(creates.alters, alters.alters...)
+	for i := len(old) - 1; i >= 0; i-- {
+		if newTables[strings.ToLower(old[i].Name)] {
+			continue
+		}
+		drop, err := CraftDrop(d, old[i].Name, DropOptions{Schema: old[i].Options.Schema})
+		if err != nil {
+			return nil, nil, err
+		}
+		changes = append(changes, Change{
+			Kind:        AlterDropTable,
+			Table:       old[i].Name,
+			Statement:   drop,
+			Destructive: true,
+		})
+		definitions = append(definitions, AlterDefinition{
+			Kind:  AlterDropTable,
+			Table: qualifiedName(old[i].Options.Schema, old[i].Name),
+			Name:  old[i].Name,
+		})
+	}
+	return changes, definitions, nil
+}
+
+// Diff returns the changes that turn the table of the old marshaller into
+// the one of this marshaller, see DiffTables.
+func (s *SQLMarshaller) Diff(driver SQLDriver, old *SQLMarshaller) ([]Change, error) {
+	from, err := old.tokenized.tableDefinition(old.Name(), old.namer)
+	if err != nil {
+		return nil, fmt.Errorf("gattering the fields of %q: %w", old.Name(), err)
+	}
+	to, err := s.tokenized.tableDefinition(s.Name(), s.namer)
+	if err != nil {
+		return nil, fmt.Errorf("gattering the fields of %q: %w", s.Name(), err)
+	}
+	return DiffTables(driver, from, to)
+}
+
+// Diff returns the changes that turn the tables of the old schema into
+// the ones of this schema, see DiffSchemas.
+func (s *Schema) Diff(driver SQLDriver, old *Schema) ([]Change, error) {
+	from, err := old.Definitions()
+	if err != nil {
+		return nil, err
+	}
+	to, err := s.Definitions()
+	if err != nil {
+		return nil, err
+	}
+	return DiffSchemas(driver, from, to)
+}
@@ -0,0 +1,45 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+var (
+	// ErrNoPrimaryKey is returned when a table has no primary key but
+	// needs one, such as to DELETE a single row or to be referenced by
+	// a has many field.
+	ErrNoPrimaryKey = errors.New("no primary key")
+	// ErrDuplicateField is returned when a table holds two columns, or
+	// a statement two values, with the same name.
+	ErrDuplicateField = errors.New("duplicate column")
+	// ErrNoComments is returned by drivers whose dialect cannot
+	// comment tables or columns.
+	ErrNoComments = errors.New("the dialect has no comments")
+	// ErrDuplicateTable is returned when a Schema already holds a table
+	// with the name of the one being registered.
+	ErrDuplicateTable = errors.New("table already registered")
+)
+
+// ErrUnsupportedType is returned for a field of a Go kind that cannot be
+// held in a column, or of an SQL Type the driver cannot define, Field is
+// empty when the field is not known.
+type ErrUnsupportedType struct {
+	Field string
+	Kind  reflect.Kind
+	Type  ANSISQLFieldKind
+}
+
+// Error implements error.
+func (e *ErrUnsupportedType) Error() string {
+	if e.Type != SqlInvalid {
+		return fmt.Sprintf("cannot determine an SQL Definition for field %q of type %v in the provided driver", e.Field, ansiTypes[e.Type])
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("cannot convert %v to any valid SQL type", e.Kind)
+	}
+	return fmt.Sprintf("cannot convert field %q of kind %v to any valid SQL type", e.Field, e.Kind)
+}
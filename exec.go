@@ -0,0 +1,45 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrVersionConflict is returned when an UPDATE guarded by a version
+// field affected no rows, which means the row was changed or removed
+// since it was read.
+var ErrVersionConflict = errors.New("version conflict, the row was modified concurrently")
+
+// Execer is the subset of *sql.DB and *sql.Tx used to run the
+// statements produced by a SQLMarshaller.
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// ExecUpdatePK runs the UpdatePK statement for the passed object in db
+// and returns ErrVersionConflict if the object has a version field and
+// no row was affected.
+func (s *SQLMarshaller) ExecUpdatePK(db Execer, in interface{}) error {
+	q, err := s.UpdatePK(in)
+	if err != nil {
+		return err
+	}
+	res, err := db.Exec(q)
+	if err != nil {
+		return fmt.Errorf("executing UPDATE statement: %w", err)
+	}
+	if _, ok := s.tokenized.version(); !ok {
+		return nil
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("determining affected rows: %w", err)
+	}
+	if affected == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
@@ -35,7 +35,7 @@ func (f *FieldsWithValue) Add(fields ...FieldWithValue) error {
 	for _, field := range fields {
 		_, ok := f.innerRegistry[field.Name]
 		if ok {
-			return fmt.Errorf("field %q already present", field.Name)
+			return fmt.Errorf("%w %q", ErrDuplicateField, field.Name)
 		}
 		f.fields = append(f.fields, field)
 		f.innerRegistry[field.Name] = len(f.fields) - 1
@@ -43,6 +43,27 @@ func (f *FieldsWithValue) Add(fields ...FieldWithValue) error {
 	return nil
 }
 
+// Set replaces the value of an existing FieldWithValue or adds it
+// if it is not present.
+func (f *FieldsWithValue) Set(field FieldWithValue) {
+	i, ok := f.innerRegistry[field.Name]
+	if !ok {
+		f.Add(field)
+		return
+	}
+	f.fields[i] = field
+}
+
+// Get returns the FieldWithValue with the passed name and a bool
+// indicating if it exists.
+func (f *FieldsWithValue) Get(name string) (FieldWithValue, bool) {
+	i, ok := f.innerRegistry[name]
+	if !ok {
+		return FieldWithValue{}, false
+	}
+	return f.fields[i], true
+}
+
 // Pop removes and returns a Field and a bool indicating if
 // the field exists.
 func (f *FieldsWithValue) Pop(name string) (FieldWithValue, bool) {
@@ -56,6 +77,10 @@ func (f *FieldsWithValue) Pop(name string) (FieldWithValue, bool) {
 		if field.Name == name {
 			a := append(f.fields[:i], f.fields[i+1:]...)
 			f.fields = a
+			// positions after the removed one have shifted.
+			for j := i; j < len(f.fields); j++ {
+				f.innerRegistry[f.fields[j].Name] = j
+			}
 			return field, true
 		}
 	}
@@ -0,0 +1,322 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// goTypes maps each ANSISQLFieldKind to the Go type that is tokenized
+// as it or, if none is, the closest one.
+var goTypes = map[ANSISQLFieldKind]string{
+	SqlChar:       "string",
+	SqlVarchar:    "string",
+	SqlNchar:      "string",
+	SqlNVarchar:   "string",
+	SqlBit:        "string",
+	SqlBitVarying: "string",
+	SqlInt:        "int32",
+	SqlSmallInt:   "int",
+	SqlBigInt:     "int64",
+	SqlFloat:      "float32",
+	SqlReal:       "float32",
+	SqlDouble:     "float64",
+	SqlNumeric:    "float64",
+	SqlDecimal:    "float64",
+	SqlTimestamp:  "time.Time",
+}
+
+// identifier returns name as a valid Go identifier, replacing the
+// characters that cannot be part of it by underscores.
+func identifier(name string) string {
+	id := []rune(name)
+	for i, r := range id {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9') {
+			id[i] = '_'
+		}
+	}
+	result := string(id)
+	if result == "" || result[0] >= '0' && result[0] <= '9' {
+		result = "_" + result
+	}
+	if token.IsKeyword(result) {
+		result += "_"
+	}
+	return result
+}
+
+// initialisms are the words written in upper case in exported names.
+var initialisms = map[string]bool{
+	"api":  true,
+	"http": true,
+	"id":   true,
+	"ip":   true,
+	"json": true,
+	"sql":  true,
+	"url":  true,
+	"uuid": true,
+}
+
+// exported returns name as an exported Go identifier in camel case, its
+// words are separated by underscores or any other character that cannot
+// be part of it.
+func exported(name string) string {
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	})
+	result := ""
+	for _, word := range words {
+		if initialisms[strings.ToLower(word)] {
+			result += strings.ToUpper(word)
+			continue
+		}
+		result += strings.ToUpper(word[:1]) + word[1:]
+	}
+	if result == "" || result[0] >= '0' && result[0] <= '9' {
+		result = "X" + result
+	}
+	return result
+}
+
+// fkFieldName returns the name of the field a Foreign Key was created
+// from, which prefixes its columns, or the referenced table if the
+// columns are not named after a field.
+func fkFieldName(fk FKDefinition) string {
+	var field string
+	for i := range fk.Names {
+		suffix := fmt.Sprintf("_%s_fk", fk.RemoteNames[i])
+		if !strings.HasSuffix(fk.Names[i], suffix) {
+			return fk.RemoteTable
+		}
+		name := strings.TrimSuffix(fk.Names[i], suffix)
+		if i > 0 && name != field {
+			return fk.RemoteTable
+		}
+		field = name
+	}
+	return field
+}
+
+// structField is a field of a generated struct, the name of the column
+// it is tokenized as and the columns of the table it holds.
+type structField struct {
+	name    string
+	column  string
+	goType  string
+	columns []string
+	tags    []string
+}
+
+// sameColumns returns true if both lists hold the same columns in the same
+// order.
+func sameColumns(a, b []string) bool {
+	return strings.Join(a, ",") == strings.Join(b, ",")
+}
+
+// containsAll returns true if all of the columns are in the list.
+func containsAll(list, columns []string) bool {
+	for _, c := range columns {
+		found := false
+		for _, l := range list {
+			found = found || l == c
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// tagValue returns the passed tag with value, or a note about it if the
+// value cannot be expressed in a tag.
+func tagValue(tag, value string) (string, string) {
+	if strings.ContainsAny(value, ",`\"") {
+		return "", fmt.Sprintf("%s=%s cannot be expressed with tags.", tag, value)
+	}
+	return fmt.Sprintf("%s=%s", tag, value), ""
+}
+
+// structFields returns the fields of the struct for the passed table, one
+// of the passed tables, and notes about what the tags cannot express.
+func structFields(table TableDefinition, tables []TableDefinition) ([]structField, []string, error) {
+	fields := []structField{}
+	notes := []string{}
+	fkOf := map[string]int{}
+	for i, fk := range table.FKs {
+		for _, name := range fk.Names {
+			fkOf[name] = i
+		}
+	}
+	done := map[int]bool{}
+	used := map[string]bool{}
+	// named returns the field holding the passed column, exported and
+	// tagged with the name of the column if it is not the same.
+	named := func(column string) structField {
+		field := structField{name: exported(column), column: column}
+		for used[field.name] {
+			field.name += "_"
+		}
+		used[field.name] = true
+		if field.name != column {
+			tag, note := tagValue(tagColumn, column)
+			if note != "" {
+				notes = append(notes, fmt.Sprintf("%s: %s", column, note))
+			} else {
+				field.tags = append(field.tags, tag)
+			}
+		}
+		return field
+	}
+	for _, f := range table.Fields {
+		i, isFK := fkOf[f.Name]
+		if isFK {
+			if done[i] {
+				continue
+			}
+			done[i] = true
+			fk := table.FKs[i]
+			if !hasTable(tables, fk.RemoteTable) {
+				return nil, nil, fmt.Errorf("table %q: foreign key %v references table %q which is not generated", table.Name, fk.Names, fk.RemoteTable)
+			}
+			field := named(fkFieldName(fk))
+			field.goType = "*" + identifier(fk.RemoteTable)
+			field.columns = fk.Names
+			actions := []FKAction{fk.OnDelete, fk.OnUpdate}
+			for j, tag := range []string{tagOnDelete, tagOnUpdate} {
+				for name, action := range fkActions {
+					if action == actions[j] && action != FKCascade {
+						field.tags = append(field.tags, fmt.Sprintf("%s=%s", tag, name))
+					}
+				}
+			}
+			fields = append(fields, field)
+			continue
+		}
+		goType := goTypes[f.Type]
+		field := named(f.Name)
+		field.goType, field.columns = goType, []string{f.Name}
+		if f.Nullable && !containsAll(table.PKs, field.columns) {
+			field.goType = "*" + goType
+		}
+		if f.Size > 0 {
+			field.tags = append(field.tags, fmt.Sprintf("%s=%d", tagSize, f.Size))
+		}
+		values := [][2]string{}
+		if f.Default != "" {
+			def := f.Default
+			if unquoted, err := strconv.Unquote(def); err == nil && (goType == "string" || goType == "time.Time") {
+				def = unquoted
+			}
+			values = append(values, [2]string{tagDefault, def})
+		}
+		values = append(values, [2]string{tagCheck, f.Check}, [2]string{tagComment, f.Comment})
+		for _, v := range values {
+			if v[1] == "" {
+				continue
+			}
+			tag, note := tagValue(v[0], v[1])
+			if note != "" {
+				notes = append(notes, fmt.Sprintf("%s: %s", f.Name, note))
+				continue
+			}
+			field.tags = append(field.tags, tag)
+		}
+		fields = append(fields, field)
+	}
+	for i := range fields {
+		f := &fields[i]
+		if len(table.PKs) != 0 && containsAll(table.PKs, f.columns) {
+			f.tags = append([]string{tagPrimary}, f.tags...)
+		}
+	}
+	for _, u := range table.Uniques {
+		expressed := false
+		for i := range fields {
+			if sameColumns(fields[i].columns, u.Columns) {
+				fields[i].tags = append(fields[i].tags, tagUnique)
+				expressed = true
+			}
+		}
+		if !expressed {
+			notes = append(notes, fmt.Sprintf("UNIQUE (%s) cannot be expressed with tags.", strings.Join(u.Columns, ", ")))
+		}
+	}
+	for _, index := range table.Indexes {
+		tag := tagIndex
+		if index.Unique {
+			tag = tagUniqueIndex
+		}
+		members := []int{}
+		columns := []string{}
+		for i := range fields {
+			if containsAll(index.Columns, fields[i].columns) {
+				members = append(members, i)
+				columns = append(columns, fields[i].columns...)
+			}
+		}
+		if !sameColumns(columns, index.Columns) {
+			notes = append(notes, fmt.Sprintf("index %s (%s) cannot be expressed with tags.", index.Name, strings.Join(index.Columns, ", ")))
+			continue
+		}
+		prefix := "idx"
+		if index.Unique {
+			prefix = "uidx"
+		}
+		for _, i := range members {
+			if len(members) == 1 && index.Name == fmt.Sprintf("%s_%s_%s", prefix, table.Name, fields[i].column) {
+				fields[i].tags = append(fields[i].tags, tag)
+				continue
+			}
+			fields[i].tags = append(fields[i].tags, fmt.Sprintf("%s=%s", tag, index.Name))
+		}
+	}
+	return fields, notes, nil
+}
+
+// GenerateStructs returns the Go source, in the passed package, of a struct
+// for each of the passed tables, such as those in a map based schema or
+// read by Introspect, which produces the same CREATE statements as far as
+// tags can express them, Foreign Keys are pointers to the referenced struct,
+// which must be one of the tables, and nullable columns pointers to their
+// type. What cannot be expressed is noted in the comments of each struct.
+func GenerateStructs(pkg string, tables []TableDefinition) ([]byte, error) {
+	body := &bytes.Buffer{}
+	usesTime := false
+	for _, table := range tables {
+		fields, notes, err := structFields(table, tables)
+		if err != nil {
+			return nil, err
+		}
+		name := identifier(table.Name)
+		fmt.Fprintf(body, "\n// %s holds the rows of the table %s.\n", name, table.Name)
+		for _, note := range notes {
+			fmt.Fprintf(body, "// %s\n", note)
+		}
+		fmt.Fprintf(body, "type %s struct {\n", name)
+		for _, f := range fields {
+			usesTime = usesTime || strings.HasSuffix(f.goType, "time.Time")
+			fmt.Fprintf(body, "%s %s", f.name, f.goType)
+			if len(f.tags) != 0 {
+				fmt.Fprintf(body, " `sql:\"%s\"`", strings.Join(f.tags, ","))
+			}
+			fmt.Fprintln(body)
+		}
+		fmt.Fprintln(body, "}")
+	}
+	source := &bytes.Buffer{}
+	fmt.Fprintf(source, "package %s\n", pkg)
+	if usesTime {
+		fmt.Fprintln(source, "\nimport \"time\"")
+	}
+	source.Write(body.Bytes())
+	formatted, err := format.Source(source.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("formatting the generated source: %w", err)
+	}
+	return formatted, nil
+}
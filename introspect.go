@@ -0,0 +1,555 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Querier is the subset of *sql.DB and *sql.Tx used to read the schema
+// of a live database.
+type Querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// Introspector is implemented by the drivers that can read the schema
+// of a live database.
+type Introspector interface {
+	// Introspect returns the definitions of the tables in the
+	// database, CHECK constraints are not read. Columns are never
+	// created NOT NULL so all but the primary keys of the tables
+	// this package creates are read as nullable.
+	Introspect(db Querier) ([]TableDefinition, error)
+}
+
+// Introspect returns the definitions of the tables of the database as read
+// by the passed driver, sorted so tables come after the ones they reference
+// unless they reference each other.
+func Introspect(d SQLDriver, db Querier) ([]TableDefinition, error) {
+	introspector, ok := d.(Introspector)
+	if !ok {
+		return nil, fmt.Errorf("the driver cannot read the schema of a database")
+	}
+	tables, err := introspector.Introspect(db)
+	if err != nil {
+		return nil, fmt.Errorf("reading the schema: %w", err)
+	}
+	return sortTables(tables), nil
+}
+
+// Drift returns the changes that turn the schema of the live database into
+// this schema, none if they are the same.
+func (s *Schema) Drift(driver SQLDriver, db Querier) ([]Change, error) {
+	live, err := Introspect(driver, db)
+	if err != nil {
+		return nil, err
+	}
+	current, err := s.Definitions()
+	if err != nil {
+		return nil, err
+	}
+	return DiffSchemas(driver, live, current)
+}
+
+// sortTables returns the passed tables sorted so every table comes after
+// the ones it references, keeping the order of the rest, tables in a
+// cycle are left at the end in their order.
+func sortTables(tables []TableDefinition) []TableDefinition {
+	sorted := make([]TableDefinition, 0, len(tables))
+	pending := append([]TableDefinition{}, tables...)
+	for len(pending) != 0 {
+		next := -1
+		for i := range pending {
+			if !references(pending[i], pending) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			return append(sorted, pending...)
+		}
+		sorted = append(sorted, pending[next])
+		pending = append(pending[:next], pending[next+1:]...)
+	}
+	return sorted
+}
+
+// references returns true if table has Foreign Keys to any of the others.
+func references(table TableDefinition, others []TableDefinition) bool {
+	for _, fk := range table.FKs {
+		if !strings.EqualFold(fk.RemoteTable, table.Name) && hasTable(others, fk.RemoteTable) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasTable returns true if there is a table named name in tables.
+func hasTable(tables []TableDefinition, name string) bool {
+	for _, t := range tables {
+		if strings.EqualFold(t.Name, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// introspectedTypes maps the names of the types, as databases report
+// them, to their ANSISQLFieldKind.
+var introspectedTypes = map[string]ANSISQLFieldKind{
+	"character":                   SqlChar,
+	"char":                        SqlChar,
+	"character varying":           SqlVarchar,
+	"varchar":                     SqlVarchar,
+	"text":                        SqlVarchar,
+	"tinytext":                    SqlVarchar,
+	"mediumtext":                  SqlVarchar,
+	"longtext":                    SqlVarchar,
+	"national character":          SqlNchar,
+	"nchar":                       SqlNchar,
+	"national character varying":  SqlNVarchar,
+	"nvarchar":                    SqlNVarchar,
+	"bit":                         SqlBit,
+	"bit varying":                 SqlBitVarying,
+	"varbit":                      SqlBitVarying,
+	"int":                         SqlInt,
+	"integer":                     SqlInt,
+	"mediumint":                   SqlInt,
+	"smallint":                    SqlSmallInt,
+	"tinyint":                     SqlSmallInt,
+	"bigint":                      SqlBigInt,
+	"float":                       SqlFloat,
+	"real":                        SqlReal,
+	"double":                      SqlDouble,
+	"double precision":            SqlDouble,
+	"numeric":                     SqlNumeric,
+	"decimal":                     SqlDecimal,
+	"timestamp":                   SqlTimestamp,
+	"timestamp without time zone": SqlTimestamp,
+	"timestamp with time zone":    SqlTimestamp,
+	"datetime":                    SqlTimestamp,
+}
+
+// introspectedType returns the ANSISQLFieldKind for the passed type name
+// and its size, zero if it has none, the scale of numbers is ignored.
+func introspectedType(column, name string) (ANSISQLFieldKind, int, error) {
+	normalized := strings.ToLower(name)
+	size := 0
+	if i := strings.Index(normalized, "("); i >= 0 {
+		arguments := strings.TrimSuffix(normalized[i+1:], ")")
+		if j := strings.Index(arguments, ","); j >= 0 {
+			arguments = arguments[:j]
+		}
+		var err error
+		if size, err = strconv.Atoi(strings.TrimSpace(arguments)); err != nil {
+			return SqlInvalid, 0, fmt.Errorf("unknown size of type %q of column %q", name, column)
+		}
+		normalized = normalized[:i]
+	}
+	kind, ok := introspectedTypes[strings.TrimSpace(normalized)]
+	if !ok {
+		return SqlInvalid, 0, fmt.Errorf("unknown type %q of column %q", name, column)
+	}
+	return kind, size, nil
+}
+
+// queryStrings returns the values of the first column of the rows
+// returned by query.
+func queryStrings(db Querier, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	values := []string{}
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// each calls f for each of the rows returned by query.
+func each(db Querier, query string, f func(*sql.Rows) error) error {
+	rows, err := db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := f(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// informationSchema holds the queries reading the schema of a database
+// from its information_schema, which dialects scope to the current schema
+// differently, and the function turning the defaults they report into the
+// literals Definitions render.
+type informationSchema struct {
+	tables, columns, keys, fks string
+	defaultOf                  func(def string, kind ANSISQLFieldKind) string
+}
+
+const (
+	pgTablesQuery = `SELECT table_name FROM information_schema.tables
+WHERE table_schema = CURRENT_SCHEMA AND table_type = 'BASE TABLE' ORDER BY table_name`
+	pgColumnsQuery = `SELECT column_name, data_type, character_maximum_length, column_default, is_nullable
+FROM information_schema.columns
+WHERE table_schema = CURRENT_SCHEMA AND table_name = %s ORDER BY ordinal_position`
+	pgKeysQuery = `SELECT tc.constraint_name, tc.constraint_type, kcu.column_name
+FROM information_schema.table_constraints tc
+JOIN information_schema.key_column_usage kcu ON kcu.constraint_schema = tc.constraint_schema
+AND kcu.constraint_name = tc.constraint_name AND kcu.table_name = tc.table_name
+WHERE tc.table_schema = CURRENT_SCHEMA AND tc.table_name = %s AND tc.constraint_type IN ('PRIMARY KEY', 'UNIQUE')
+ORDER BY tc.constraint_name, kcu.ordinal_position`
+	pgFKsQuery = `SELECT kcu.constraint_name, kcu.column_name, ccu.table_name, ccu.column_name, rc.delete_rule, rc.update_rule
+FROM information_schema.referential_constraints rc
+JOIN information_schema.key_column_usage kcu ON kcu.constraint_schema = rc.constraint_schema
+AND kcu.constraint_name = rc.constraint_name
+JOIN information_schema.key_column_usage ccu ON ccu.constraint_schema = rc.unique_constraint_schema
+AND ccu.constraint_name = rc.unique_constraint_name AND ccu.ordinal_position = kcu.position_in_unique_constraint
+WHERE kcu.table_schema = CURRENT_SCHEMA AND kcu.table_name = %s
+ORDER BY kcu.constraint_name, kcu.ordinal_position`
+)
+
+// pgInformationSchema reads the CURRENT_SCHEMA, which is PostgreSQL
+// specific.
+var pgInformationSchema = informationSchema{
+	tables:    pgTablesQuery,
+	columns:   pgColumnsQuery,
+	keys:      pgKeysQuery,
+	fks:       pgFKsQuery,
+	defaultOf: pgDefault,
+}
+
+// pgCasts matches the casts PostgreSQL appends to the defaults it reports,
+// such as 'x'::character varying.
+var pgCasts = regexp.MustCompile(`(::[a-z ]+(\([0-9, ]+\))?(\[\])?)+$`)
+
+// pgDefault returns the passed default as PostgreSQL reports it without
+// its casts, strings are single quoted, and none for the sequences of
+// serial columns, which Definitions know nothing about.
+func pgDefault(def string, kind ANSISQLFieldKind) string {
+	def = pgCasts.ReplaceAllString(def, "")
+	if strings.HasPrefix(def, "nextval(") {
+		return ""
+	}
+	if len(def) >= 2 && def[0] == '\'' && def[len(def)-1] == '\'' {
+		def = strings.Replace(def[1:len(def)-1], "''", "'", -1)
+		if !isNumberKind(kind) {
+			return strconv.Quote(def)
+		}
+	}
+	return numberDefault(def, kind)
+}
+
+// isNumberKind returns true if the passed kind holds numbers.
+func isNumberKind(kind ANSISQLFieldKind) bool {
+	switch kind {
+	case SqlInt, SqlSmallInt, SqlBigInt, SqlFloat, SqlReal, SqlDouble, SqlNumeric, SqlDecimal:
+		return true
+	}
+	return false
+}
+
+// numberDefault returns the passed default of a column of the passed kind
+// with floating point numbers formatted as literals of Go floats are.
+func numberDefault(def string, kind ANSISQLFieldKind) string {
+	switch kind {
+	case SqlFloat, SqlReal, SqlDouble, SqlNumeric, SqlDecimal:
+		if f, err := strconv.ParseFloat(def, 64); err == nil {
+			return fmt.Sprintf("%f", f)
+		}
+	}
+	return def
+}
+
+// Introspect implements Introspector reading the information_schema of
+// the CURRENT_SCHEMA. Indexes are not part of it and thus not read.
+func (*PostgreSQLDriver) Introspect(db Querier) ([]TableDefinition, error) {
+	return pgInformationSchema.introspect(db)
+}
+
+// introspect returns the definitions of the tables read with the queries
+// of the information schema.
+func (is informationSchema) introspect(db Querier) ([]TableDefinition, error) {
+	names, err := queryStrings(db, is.tables)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]TableDefinition, len(names))
+	for i, name := range names {
+		table := TableDefinition{Name: name}
+		err := each(db, fmt.Sprintf(is.columns, quoteString(name)), func(rows *sql.Rows) error {
+			var column, dataType, nullable string
+			var size sql.NullInt64
+			var def sql.NullString
+			if err := rows.Scan(&column, &dataType, &size, &def, &nullable); err != nil {
+				return err
+			}
+			kind, _, err := introspectedType(column, dataType)
+			if err != nil {
+				return err
+			}
+			field := FieldDefinition{
+				Name:     column,
+				Type:     kind,
+				Size:     int(size.Int64),
+				Nullable: nullable == "YES",
+			}
+			if def.Valid {
+				field.Default = is.defaultOf(def.String, kind)
+			}
+			table.Fields = append(table.Fields, field)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading the columns of %q: %w", name, err)
+		}
+		err = each(db, fmt.Sprintf(is.keys, quoteString(name)), func(rows *sql.Rows) error {
+			var constraint, kind, column string
+			if err := rows.Scan(&constraint, &kind, &column); err != nil {
+				return err
+			}
+			if kind == "PRIMARY KEY" {
+				table.PKName = constraint
+				table.PKs = append(table.PKs, column)
+				return nil
+			}
+			if n := len(table.Uniques); n == 0 || table.Uniques[n-1].Name != constraint {
+				table.Uniques = append(table.Uniques, UniqueDefinition{Name: constraint})
+			}
+			u := &table.Uniques[len(table.Uniques)-1]
+			u.Columns = append(u.Columns, column)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading the keys of %q: %w", name, err)
+		}
+		err = each(db, fmt.Sprintf(is.fks, quoteString(name)), func(rows *sql.Rows) error {
+			var constraint, column, remoteTable, remoteColumn, onDelete, onUpdate string
+			if err := rows.Scan(&constraint, &column, &remoteTable, &remoteColumn, &onDelete, &onUpdate); err != nil {
+				return err
+			}
+			if n := len(table.FKs); n == 0 || table.FKs[n-1].Name != constraint {
+				table.FKs = append(table.FKs, FKDefinition{
+					Name:        constraint,
+					RemoteTable: remoteTable,
+					OnDelete:    FKAction(onDelete),
+					OnUpdate:    FKAction(onUpdate),
+				})
+			}
+			fk := &table.FKs[len(table.FKs)-1]
+			fk.Names = append(fk.Names, column)
+			fk.RemoteNames = append(fk.RemoteNames, remoteColumn)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading the foreign keys of %q: %w", name, err)
+		}
+		tables[i] = table
+	}
+	return tables, nil
+}
+
+const (
+	mysqlTablesQuery = `SELECT table_name FROM information_schema.tables
+WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE' ORDER BY table_name`
+	mysqlColumnsQuery = `SELECT column_name, data_type,
+CASE WHEN data_type IN ('char', 'varchar') THEN character_maximum_length END, column_default, is_nullable
+FROM information_schema.columns
+WHERE table_schema = DATABASE() AND table_name = %s ORDER BY ordinal_position`
+	mysqlKeysQuery = `SELECT tc.constraint_name, tc.constraint_type, kcu.column_name
+FROM information_schema.table_constraints tc
+JOIN information_schema.key_column_usage kcu ON kcu.constraint_schema = tc.constraint_schema
+AND kcu.constraint_name = tc.constraint_name AND kcu.table_name = tc.table_name
+WHERE tc.table_schema = DATABASE() AND tc.table_name = %s AND tc.constraint_type IN ('PRIMARY KEY', 'UNIQUE')
+ORDER BY tc.constraint_name, kcu.ordinal_position`
+	mysqlFKsQuery = `SELECT kcu.constraint_name, kcu.column_name, kcu.referenced_table_name, kcu.referenced_column_name,
+rc.delete_rule, rc.update_rule
+FROM information_schema.key_column_usage kcu
+JOIN information_schema.referential_constraints rc ON rc.constraint_schema = kcu.constraint_schema
+AND rc.constraint_name = kcu.constraint_name
+WHERE kcu.table_schema = DATABASE() AND kcu.table_name = %s AND kcu.referenced_table_name IS NOT NULL
+ORDER BY kcu.constraint_name, kcu.ordinal_position`
+)
+
+// mysqlInformationSchema reads the schema of the current DATABASE(),
+// character lengths are only read for the types that take one as MySQL
+// reports them for text types too.
+var mysqlInformationSchema = informationSchema{
+	tables:    mysqlTablesQuery,
+	columns:   mysqlColumnsQuery,
+	keys:      mysqlKeysQuery,
+	fks:       mysqlFKsQuery,
+	defaultOf: mysqlDefault,
+}
+
+// mysqlDefault returns the passed default as MySQL reports it, literals
+// are not quoted and expressions, such as CURRENT_TIMESTAMP, are not
+// either so only the strings of character columns are quoted.
+func mysqlDefault(def string, kind ANSISQLFieldKind) string {
+	switch kind {
+	case SqlChar, SqlVarchar, SqlNchar, SqlNVarchar:
+		return strconv.Quote(def)
+	case SqlTimestamp:
+		if _, err := time.Parse(timestampLayout, def); err == nil {
+			return strconv.Quote(def)
+		}
+	}
+	return numberDefault(def, kind)
+}
+
+// Introspect implements Introspector reading the information_schema of
+// the current DATABASE(). Indexes are not read, as for PostgreSQL.
+func (*MySQLDriver) Introspect(db Querier) ([]TableDefinition, error) {
+	return mysqlInformationSchema.introspect(db)
+}
+
+const (
+	sqliteTablesQuery     = `SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY rowid`
+	sqliteColumnsQuery    = `PRAGMA table_info(%s)`
+	sqliteFKsQuery        = `PRAGMA foreign_key_list(%s)`
+	sqliteIndexesQuery    = `PRAGMA index_list(%s)`
+	sqliteIndexInfoQuery  = `PRAGMA index_info(%s)`
+	sqliteUniqueOrigin    = "u"
+	sqliteCreateIdxOrigin = "c"
+)
+
+// Introspect implements Introspector reading sqlite_master and the PRAGMAs
+// describing each table, SQLite does not keep the names of the constraints
+// so they are read unnamed.
+func (*SQLiteDriver) Introspect(db Querier) ([]TableDefinition, error) {
+	names, err := queryStrings(db, sqliteTablesQuery)
+	if err != nil {
+		return nil, err
+	}
+	tables := make([]TableDefinition, len(names))
+	for i, name := range names {
+		table := TableDefinition{Name: name}
+		pks := map[int]string{}
+		err := each(db, fmt.Sprintf(sqliteColumnsQuery, quoteString(name)), func(rows *sql.Rows) error {
+			var cid, notNull, pk int
+			var column, columnType string
+			var def sql.NullString
+			if err := rows.Scan(&cid, &column, &columnType, &notNull, &def, &pk); err != nil {
+				return err
+			}
+			kind, size, err := introspectedType(column, columnType)
+			if err != nil {
+				return err
+			}
+			table.Fields = append(table.Fields, FieldDefinition{
+				Name:    column,
+				Type:    kind,
+				Size:    size,
+				Default: def.String,
+				// primary keys are not taken as nullable even if
+				// SQLite lets all but INTEGER ones be NULL.
+				Nullable: notNull == 0 && pk == 0,
+			})
+			if pk > 0 {
+				pks[pk] = column
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading the columns of %q: %w", name, err)
+		}
+		for i := 1; i <= len(pks); i++ {
+			table.PKs = append(table.PKs, pks[i])
+		}
+		fks := map[int]*FKDefinition{}
+		ids := []int{}
+		err = each(db, fmt.Sprintf(sqliteFKsQuery, quoteString(name)), func(rows *sql.Rows) error {
+			var id, seq int
+			var remoteTable, column, onUpdate, onDelete, match string
+			var remoteColumn sql.NullString
+			if err := rows.Scan(&id, &seq, &remoteTable, &column, &remoteColumn, &onUpdate, &onDelete, &match); err != nil {
+				return err
+			}
+			fk, ok := fks[id]
+			if !ok {
+				fk = &FKDefinition{RemoteTable: remoteTable, OnDelete: FKAction(onDelete), OnUpdate: FKAction(onUpdate)}
+				fks[id] = fk
+				ids = append(ids, id)
+			}
+			fk.Names = append(fk.Names, column)
+			fk.RemoteNames = append(fk.RemoteNames, remoteColumn.String)
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading the foreign keys of %q: %w", name, err)
+		}
+		// foreign_key_list returns the last declared first.
+		sort.Sort(sort.Reverse(sort.IntSlice(ids)))
+		for _, id := range ids {
+			table.FKs = append(table.FKs, *fks[id])
+		}
+		type sqliteIndex struct {
+			name   string
+			unique bool
+			origin string
+		}
+		indexes := []sqliteIndex{}
+		err = each(db, fmt.Sprintf(sqliteIndexesQuery, quoteString(name)), func(rows *sql.Rows) error {
+			var seq, unique, partial int
+			var index, origin string
+			if err := rows.Scan(&seq, &index, &unique, &origin, &partial); err != nil {
+				return err
+			}
+			indexes = append(indexes, sqliteIndex{name: index, unique: unique == 1, origin: origin})
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("reading the indexes of %q: %w", name, err)
+		}
+		// index_list returns the last created first.
+		for j := len(indexes) - 1; j >= 0; j-- {
+			index := indexes[j]
+			if index.origin != sqliteUniqueOrigin && index.origin != sqliteCreateIdxOrigin {
+				continue
+			}
+			columns := []string{}
+			err := each(db, fmt.Sprintf(sqliteIndexInfoQuery, quoteString(index.name)), func(rows *sql.Rows) error {
+				var seqno, cid int
+				var column string
+				if err := rows.Scan(&seqno, &cid, &column); err != nil {
+					return err
+				}
+				columns = append(columns, column)
+				return nil
+			})
+			if err != nil {
+				return nil, fmt.Errorf("reading the index %q: %w", index.name, err)
+			}
+			if index.origin == sqliteUniqueOrigin {
+				table.Uniques = append(table.Uniques, UniqueDefinition{Columns: columns})
+				continue
+			}
+			table.Indexes = append(table.Indexes, IndexDefinition{
+				Name:    index.name,
+				Table:   name,
+				Columns: columns,
+				Unique:  index.unique,
+			})
+		}
+		sort.Slice(table.Indexes, func(i, j int) bool {
+			return table.Indexes[i].Name < table.Indexes[j].Name
+		})
+		tables[i] = table
+	}
+	return tables, nil
+}
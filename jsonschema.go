@@ -0,0 +1,305 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// jsonSchemaType is the column for a JSON Schema type and format.
+type jsonSchemaType struct {
+	kind   ANSISQLFieldKind
+	goType reflect.Kind
+	size   int
+}
+
+// jsonSchemaTypes maps the JSON Schema types, alone or followed by one of
+// their formats, to the column that holds them.
+var jsonSchemaTypes = map[string]jsonSchemaType{
+	"string":           {SqlVarchar, reflect.String, 0},
+	"string/date-time": {SqlTimestamp, reflect.Struct, 0},
+	"string/date":      {SqlTimestamp, reflect.Struct, 0},
+	"string/uuid":      {SqlChar, reflect.String, 36},
+	"integer":          {SqlInt, reflect.Int32, 0},
+	"integer/int32":    {SqlInt, reflect.Int32, 0},
+	"integer/int64":    {SqlBigInt, reflect.Int64, 0},
+	"number":           {SqlDouble, reflect.Float64, 0},
+	"number/float":     {SqlFloat, reflect.Float32, 0},
+	"number/double":    {SqlDouble, reflect.Float64, 0},
+	"boolean":          {SqlInt, reflect.Bool, 0},
+}
+
+// jsonSchemaLayouts holds the layouts of the string formats mapped to
+// timestamps, used to parse their defaults.
+var jsonSchemaLayouts = map[string]string{
+	"date-time": time.RFC3339,
+	"date":      "2006-01-02",
+}
+
+// jsonSchemaTags is the extension holding the tags of a property, in the
+// same format as the sql struct tag.
+const jsonSchemaTags = "x-sql"
+
+// LoadJSONSchema returns a Schema holding a table for each of the object
+// definitions of the passed JSON Schema or OpenAPI document, YAML or JSON,
+// found under components/schemas, definitions or $defs, see
+// TokenizeJSONSchema. Tables keep the order of the document, definitions
+// with no properties are not tables and a $ref to them is replaced by the
+// definition.
+func LoadJSONSchema(r io.Reader) (*Schema, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading the schema: %w", err)
+	}
+	var document yaml.MapSlice
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("parsing the schema: %w", err)
+	}
+	documentValues, _ := mapValues(document)
+	components, _ := mapValues(documentValues["components"])
+	definitions := yaml.MapSlice{}
+	for _, found := range []interface{}{components["schemas"], documentValues["definitions"], documentValues["$defs"]} {
+		items, _ := orderedItems(found)
+		definitions = append(definitions, items...)
+	}
+	byName := map[string]map[interface{}]interface{}{}
+	for _, item := range definitions {
+		if definition, ok := mapValues(item.Value); ok {
+			byName[fmt.Sprint(item.Key)] = definition
+		}
+	}
+	s := NewSchema()
+	for _, item := range definitions {
+		name := fmt.Sprint(item.Key)
+		if !isJSONSchemaObject(byName[name]) {
+			continue
+		}
+		tokens, err := tokenizeJSONSchema(item.Value, name, byName)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := s.register(reflect.TypeOf(item.Value), tokens); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkReferences(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// isJSONSchemaObject returns true if the passed definition is an object
+// with properties, the only ones that are tables.
+func isJSONSchemaObject(definition map[interface{}]interface{}) bool {
+	_, hasProperties := definition["properties"]
+	return hasProperties
+}
+
+// TokenizeJSONSchema returns a new tokenized struct populated from the
+// passed JSON Schema object definition, such as this OpenAPI one:
+//
+//	type: object
+//	required: [id, name]
+//	properties:
+//	  id:
+//	    type: integer
+//	    format: int64
+//	    x-sql: primary
+//	  name:
+//	    type: string
+//	    maxLength: 100
+//	  owner:
+//	    $ref: '#/components/schemas/Owner'
+//
+// Each property is a column of the kind its type and format map to, the
+// ones that are not required or are nullable accept NULL, maxLength is
+// the size of the column, description its comment and default its
+// DEFAULT. A $ref is a Foreign Key to the table named as the last part
+// of it, resolved by the Schema the table is registered in. Arrays and
+// inline objects are not columns and are skipped. Tags, such as primary,
+// are set with the x-sql extension, which takes the sql struct tag.
+func TokenizeJSONSchema(definition interface{}, name string) (*tokenized, error) {
+	return tokenizeJSONSchema(definition, name, nil)
+}
+
+// tokenizeJSONSchema is TokenizeJSONSchema replacing the $ref to the
+// passed definitions that are not objects by them.
+func tokenizeJSONSchema(definition interface{}, name string, definitions map[string]map[interface{}]interface{}) (*tokenized, error) {
+	values, ok := mapValues(definition)
+	if !ok {
+		return nil, &MapSchemaError{Table: name, Err: fmt.Errorf("must be a map, got %T", definition)}
+	}
+	required := map[string]bool{}
+	if list, ok := values["required"].([]interface{}); ok {
+		for _, r := range list {
+			required[fmt.Sprint(r)] = true
+		}
+	}
+	properties, ok := orderedItems(values["properties"])
+	if !ok {
+		return nil, &MapSchemaError{Table: name, Key: "properties", Err: fmt.Errorf("must be a map, got %T", values["properties"])}
+	}
+	var fields []tokenizedField
+	for _, property := range properties {
+		column := fmt.Sprint(property.Key)
+		schema, ok := mapValues(property.Value)
+		if !ok {
+			return nil, &MapSchemaError{Table: name, Field: column, Err: fmt.Errorf("must be a map, got %T", property.Value)}
+		}
+		field, isColumn, key, err := jsonSchemaField(column, schema, !required[column], definitions)
+		if err != nil {
+			return nil, &MapSchemaError{Table: name, Field: column, Key: key, Err: err}
+		}
+		if isColumn {
+			fields = append(fields, field)
+		}
+	}
+	return &tokenized{fields: fields, name: name}, nil
+}
+
+// jsonSchemaRef returns the $ref of the passed property schema, alone or
+// as the only element of allOf, which is how references are made nullable.
+func jsonSchemaRef(schema map[interface{}]interface{}) (string, bool) {
+	if ref, ok := schema["$ref"].(string); ok {
+		return ref, true
+	}
+	if all, ok := schema["allOf"].([]interface{}); ok && len(all) == 1 {
+		if inner, ok := mapValues(all[0]); ok {
+			return jsonSchemaRef(inner)
+		}
+	}
+	return "", false
+}
+
+// jsonSchemaField returns the tokenized field for the passed property and
+// a bool indicating if it is a column, or the key that is malformed and
+// why.
+func jsonSchemaField(name string, schema map[interface{}]interface{}, nullable bool, definitions map[string]map[interface{}]interface{}) (tokenizedField, bool, string, error) {
+	field := tokenizedField{
+		name:       name,
+		isNullable: nullable || schema["nullable"] == true,
+		onDelete:   FKCascade,
+		onUpdate:   FKCascade,
+	}
+	if ref, ok := jsonSchemaRef(schema); ok {
+		remote := ref[strings.LastIndex(ref, "/")+1:]
+		definition, known := definitions[remote]
+		if !known || isJSONSchemaObject(definition) {
+			field.referencesName = remote
+			field.goType = reflect.Ptr
+			field.kind = SqlFK
+			return field, true, jsonSchemaTags, jsonSchemaTagsOf(&field, schema)
+		}
+		// the property can add to the definition, such as a description.
+		merged := map[interface{}]interface{}{}
+		for _, m := range []map[interface{}]interface{}{definition, schema} {
+			for key, value := range m {
+				merged[key] = value
+			}
+		}
+		delete(merged, "$ref")
+		schema = merged
+	}
+
+	typeof := schema["type"]
+	// OpenAPI 3.1 and JSON Schema make types nullable with a list.
+	if types, ok := typeof.([]interface{}); ok {
+		typeof = nil
+		for _, t := range types {
+			if t == "null" {
+				field.isNullable = true
+				continue
+			}
+			typeof = t
+		}
+	}
+	if typeof == "array" || typeof == "object" {
+		return field, false, "", nil
+	}
+	if typeof == nil {
+		return field, false, "type", fmt.Errorf("is missing")
+	}
+	column, ok := jsonSchemaTypes[fmt.Sprintf("%v/%v", typeof, schema["format"])]
+	if !ok {
+		if column, ok = jsonSchemaTypes[fmt.Sprint(typeof)]; !ok {
+			return field, false, "type", fmt.Errorf("unknown type %v", typeof)
+		}
+	}
+	field.kind, field.goType, field.size = column.kind, column.goType, column.size
+	if maxLength, ok := schema["maxLength"]; ok {
+		if field.size, ok = intValue(maxLength); !ok || field.size <= 0 {
+			return field, false, "maxLength", fmt.Errorf("must be a positive integer, got %v", maxLength)
+		}
+	}
+	if description, ok := schema["description"]; ok {
+		field.comment = fmt.Sprint(description)
+	}
+	if err := jsonSchemaTagsOf(&field, schema); err != nil {
+		return field, false, jsonSchemaTags, err
+	}
+	if field.isPk {
+		field.isNullable = false
+	}
+	if def, ok := schema["default"]; ok {
+		field.defaultValue = fmt.Sprint(def)
+		if layout, ok := jsonSchemaLayouts[fmt.Sprint(schema["format"])]; ok && field.kind == SqlTimestamp {
+			t, err := time.Parse(layout, field.defaultValue)
+			if err != nil {
+				return field, false, "default", err
+			}
+			field.defaultValue = t.Format(timestampLayout)
+		}
+	}
+	literalType := kindTypes[field.goType]
+	if field.kind == SqlTimestamp {
+		literalType = timeType
+	}
+	if err := field.renderDefault(literalType); err != nil {
+		return field, false, "default", err
+	}
+	return field, true, "", nil
+}
+
+// jsonSchemaTagsOf sets the tags in the x-sql extension of the passed
+// property schema on field.
+func jsonSchemaTagsOf(field *tokenizedField, schema map[interface{}]interface{}) error {
+	if tags, ok := schema[jsonSchemaTags]; ok {
+		if err := field.processTags(reflect.StructTag(fmt.Sprintf("sql:%q", fmt.Sprint(tags)))); err != nil {
+			return err
+		}
+	}
+	if field.isVersion && !isIntegerKind(field.goType) {
+		return fmt.Errorf("version field %q must be an integer, got %v", field.name, field.goType)
+	}
+	if !field.isNullable && (field.onDelete == FKSetNull || field.onUpdate == FKSetNull) {
+		return fmt.Errorf("foreign key field %q must be nullable to be set to NULL", field.name)
+	}
+	return nil
+}
+
+// orderedItems returns the keys and values of the passed map keeping the
+// order of a yaml.MapSlice and sorting the keys of any other map, and a
+// bool indicating if it is a map at all.
+func orderedItems(in interface{}) (yaml.MapSlice, bool) {
+	if items, ok := in.(yaml.MapSlice); ok {
+		return items, true
+	}
+	values, ok := mapValues(in)
+	if !ok {
+		return nil, false
+	}
+	items := make(yaml.MapSlice, 0, len(values))
+	for key, value := range values {
+		items = append(items, yaml.MapItem{Key: key, Value: value})
+	}
+	sort.Slice(items, func(i, j int) bool { return fmt.Sprint(items[i].Key) < fmt.Sprint(items[j].Key) })
+	return items, true
+}
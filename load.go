@@ -0,0 +1,157 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LoadSchema returns a Schema holding the tables of the passed YAML or
+// JSON document, which holds the columns of each under its fields:
+//
+//	tables:
+//	  owners:
+//	    fields:
+//	      id:
+//	        type: int
+//	        primary: true
+//	  pets:
+//	    fields:
+//	      name:
+//	        type: string
+//	        size: 50
+//	      owner:
+//	        references: owners.id
+//
+// See TokenizeMap for the columns. Tables and columns keep the order of
+// the document and every Foreign Key must reference one of the tables.
+func LoadSchema(r io.Reader) (*Schema, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("reading the schema: %w", err)
+	}
+	var document struct {
+		Tables yaml.MapSlice
+	}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("parsing the schema: %w", err)
+	}
+	s := NewSchema()
+	for _, item := range document.Tables {
+		name := fmt.Sprint(item.Key)
+		table, ok := item.Value.(yaml.MapSlice)
+		if !ok {
+			return nil, &MapSchemaError{Table: name, Err: fmt.Errorf("must be a map, got %T", item.Value)}
+		}
+		var fields interface{}
+		for _, key := range table {
+			if key.Key == "fields" {
+				fields = key.Value
+			}
+		}
+		if fields == nil {
+			return nil, &MapSchemaError{Table: name, Key: "fields", Err: fmt.Errorf("is missing")}
+		}
+		if _, err := s.Register(fields, name); err != nil {
+			return nil, err
+		}
+	}
+	if err := s.checkReferences(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// checkReferences returns an error if a Foreign Key declared in a map
+// references a table that is not registered or a column that is not
+// the primary key of its table.
+func (s *Schema) checkReferences() error {
+	for _, m := range s.tables {
+		for _, f := range m.tokenized.fields {
+			if f.referencesName == "" {
+				continue
+			}
+			if err := f.checkReferences(m.Name()); err != nil {
+				return err
+			}
+			parts := strings.SplitN(f.referencesName, ".", 2)
+			if len(parts) == 1 {
+				continue
+			}
+			pk, err := f.references.primary()
+			if err != nil {
+				return err
+			}
+			if len(pk) != 1 || pk[0] != parts[1] {
+				return &MapSchemaError{
+					Table: m.Name(),
+					Field: f.name,
+					Key:   "references",
+					Err:   fmt.Errorf("%q is not the primary key of %q", parts[1], parts[0]),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// TokenizeMapSlice is TokenizeMap for a yaml.MapSlice, as decoded from
+// a document, the columns keep their order in it.
+func TokenizeMapSlice(t yaml.MapSlice, name string) (*tokenized, error) {
+	columns := make([]mapColumn, len(t))
+	for i, item := range t {
+		column, err := newMapColumn(name, item.Key, item.Value)
+		if err != nil {
+			return nil, err
+		}
+		columns[i] = column
+	}
+	return tokenizeColumns(columns, name)
+}
+
+// tokenizeMap tokenizes the passed map based table in any of the shapes
+// documents are decoded as, see TokenizeMap.
+func tokenizeMap(in interface{}, name string) (*tokenized, error) {
+	switch t := in.(type) {
+	case yaml.MapSlice:
+		return TokenizeMapSlice(t, name)
+	case map[interface{}]interface{}:
+		return TokenizeMap(t, name)
+	}
+	columns, ok := mapValues(in)
+	if !ok {
+		return nil, &MapSchemaError{Table: name, Err: fmt.Errorf("columns must be a map, got %T", in)}
+	}
+	return TokenizeMap(columns, name)
+}
+
+// mapValues returns the passed map, a yaml.MapSlice or a map of any type,
+// such as the map[string]interface{} decoded from JSON, as a
+// map[interface{}]interface{} and a bool indicating if it is a map at all.
+func mapValues(in interface{}) (map[interface{}]interface{}, bool) {
+	switch m := in.(type) {
+	case map[interface{}]interface{}:
+		return m, true
+	case yaml.MapSlice:
+		values := make(map[interface{}]interface{}, len(m))
+		for _, item := range m {
+			values[item.Key] = item.Value
+		}
+		return values, true
+	}
+	v := reflect.ValueOf(in)
+	if v.Kind() != reflect.Map {
+		return nil, false
+	}
+	values := make(map[interface{}]interface{}, v.Len())
+	for _, key := range v.MapKeys() {
+		values[key.Interface()] = v.MapIndex(key).Interface()
+	}
+	return values, true
+}
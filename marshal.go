@@ -5,12 +5,47 @@ package sqlmarshal
 import (
 	"fmt"
 	"reflect"
+	"strings"
+	"time"
 )
 
 // SQLMarshaller is a marshaller for a given type of object.
 type SQLMarshaller struct {
 	typeOf    reflect.Type
 	tokenized *tokenized
+	// driver renders the dialect dependent values of the
+	// statements that do not take one, such as the current time.
+	driver SQLDriver
+	clock  func() time.Time
+	namer  ConstraintNamer
+}
+
+// SetConstraintNamer sets the naming scheme for the constraints in
+// CREATE statements, by default DefaultConstraintNamer.
+func (s *SQLMarshaller) SetConstraintNamer(namer ConstraintNamer) {
+	s.namer = namer
+}
+
+// SetDriver sets the driver used to render dialect dependent values
+// in INSERT, UPDATE and DELETE statements, by default ANSISQLDriver.
+func (s *SQLMarshaller) SetDriver(driver SQLDriver) {
+	s.driver = driver
+}
+
+// SetClock sets a clock used to obtain the value for created, updated
+// and soft delete timestamps, if none is set the database current
+// timestamp is used instead.
+func (s *SQLMarshaller) SetClock(clock func() time.Time) {
+	s.clock = clock
+}
+
+// now returns the value to be used as current time in statements.
+func (s *SQLMarshaller) now() string {
+	if s.clock == nil {
+		return s.driver.CurrentTimestamp()
+	}
+	now, _ := valueStringer(reflect.ValueOf(s.clock()))
+	return now
 }
 
 // UpdatePK return an update statement for the passed object that
@@ -19,16 +54,102 @@ type SQLMarshaller struct {
 func (s *SQLMarshaller) UpdatePK(in interface{}) (string, error) {
 	pks, fields, err := s.tokenized.pksFieldsAndValues(in)
 	if err != nil {
-		return "", fmt.Errorf("extracting the pks, fields and values: %v", err)
+		return "", fmt.Errorf("extracting the pks, fields and values: %w", err)
+	}
+	if err := s.tokenized.lockVersion(in, pks, fields); err != nil {
+		return "", fmt.Errorf("adding the version lock: %w", err)
+	}
+	created, updated := s.tokenized.timestamps()
+	if created != "" {
+		fields.Pop(created)
+	}
+	if updated != "" {
+		fields.Set(FieldWithValue{Name: updated, Value: s.now()})
 	}
 	return CraftUpdate(s.Name(), pks, fields), nil
 }
 
+// DeletePK returns a delete statement for the entry represented by the pk/s
+// on the passed struct.
+// If the type has a soft delete field, an update statement marking the entry
+// as deleted is returned instead.
+func (s *SQLMarshaller) DeletePK(in interface{}) (string, error) {
+	pks, _, err := s.tokenized.pksFieldsAndValues(in)
+	if err != nil {
+		return "", fmt.Errorf("extracting the pks: %w", err)
+	}
+	if pks.Len() == 0 {
+		return "", fmt.Errorf("%q has %w, the resulting query would affect all rows", s.Name(), ErrNoPrimaryKey)
+	}
+	if f, ok := s.tokenized.softDelete(); ok {
+		fields := NewFieldsWithValue()
+		fields.Add(FieldWithValue{Name: f.name, Value: f.deletedValue(s.now())})
+		return CraftUpdate(s.Name(), pks, fields), nil
+	}
+	return CraftDelete(s.Name(), pks), nil
+}
+
+// SelectOptions holds the options that alter the SELECT statements
+// crafted by the marshaller.
+type SelectOptions struct {
+	// IncludeDeleted stops the rows marked by a soft delete field
+	// from being filtered out.
+	IncludeDeleted bool
+}
+
+// Select returns a SQL SELECT statement for all the entries of the
+// type of this marshaller.
+func (s *SQLMarshaller) Select(opts SelectOptions) (string, error) {
+	return s.selectWhere(nil, opts)
+}
+
+// SelectPK returns a SQL SELECT statement for the entry represented by
+// the pk/s on the passed struct.
+func (s *SQLMarshaller) SelectPK(in interface{}, opts SelectOptions) (string, error) {
+	pks, _, err := s.tokenized.pksFieldsAndValues(in)
+	if err != nil {
+		return "", fmt.Errorf("extracting the pks: %w", err)
+	}
+	if pks.Len() == 0 {
+		return "", fmt.Errorf("%q has %w", s.Name(), ErrNoPrimaryKey)
+	}
+	return s.selectWhere(pks.Pairs("="), opts)
+}
+
+// SelectChildren returns a SQL SELECT statement for the entries held in the
+// has many field with the passed name of the passed struct.
+func (s *SQLMarshaller) SelectChildren(in interface{}, field string, opts SelectOptions) (string, error) {
+	f, ok := s.tokenized.hasMany(field)
+	if !ok {
+		return "", fmt.Errorf("%q has no has many field %q", s.Name(), field)
+	}
+	backref, err := s.tokenized.primaryFieldsAndValuess(f.backref, reflect.ValueOf(in))
+	if err != nil {
+		return "", fmt.Errorf("crafting back reference for %q: %w", field, err)
+	}
+	child := &SQLMarshaller{typeOf: f.elemType, tokenized: f.many}
+	return child.selectWhere(backref.Pairs("="), opts)
+}
+
+// selectWhere crafts a SELECT with the passed conditions adding, unless
+// told otherwise, the one that filters out soft deleted rows.
+func (s *SQLMarshaller) selectWhere(conditions []string, opts SelectOptions) (string, error) {
+	columns, err := s.tokenized.columns()
+	if err != nil {
+		return "", fmt.Errorf("gattering the fields for SELECT statement: %w", err)
+	}
+	if f, ok := s.tokenized.softDelete(); ok && !opts.IncludeDeleted {
+		conditions = append(conditions, f.notDeletedCondition())
+	}
+	return CraftSelect(s.Name(), columns, conditions), nil
+}
+
 // Name returns the current name of the marshaller based on the type
 // if no type is provided, it uses the tokenized name
 func (s *SQLMarshaller) Name() string {
 	name := s.typeOf.Name()
-	if name == "" {
+	// maps are named when tokenized, a yaml.MapSlice is a named type.
+	if name == "" || s.typeOf.Kind() != reflect.Struct {
 		name = s.tokenized.name
 	}
 	return name
@@ -39,32 +160,354 @@ func (s *SQLMarshaller) Name() string {
 // Fields that hold structs or pointers will be considered Foreign Keys
 // Only Ptr of Stucts are supported for the moment.
 func (s *SQLMarshaller) Create(driver SQLDriver) (string, error) {
-	fields, fks, pks, err := s.tokenized.fieldsAndTypes()
+	return s.CreateWithOptions(driver, CreateOptions{})
+}
+
+// CreateWithOptions is like Create but with the passed options, which
+// the driver rejects if the dialect cannot express them. The comments
+// are not part of the statement, see Comments.
+func (s *SQLMarshaller) CreateWithOptions(driver SQLDriver, opts CreateOptions) (string, error) {
+	table, err := s.tokenized.tableDefinition(s.Name(), s.namer)
+	if err != nil {
+		return "", fmt.Errorf("gattering the fields for CREATE statement: %w", err)
+	}
+	table.Options = opts
+	return CraftCreate(driver, table)
+}
+
+// Comments returns the SQL statements setting the comment of the table of
+// this marshaller from the passed options and those of its columns from
+// their comment tags, or ErrNoComments if the dialect has none.
+func (s *SQLMarshaller) Comments(driver SQLDriver, opts CreateOptions) ([]string, error) {
+	table, err := s.tokenized.tableDefinition(s.Name(), s.namer)
+	if err != nil {
+		return nil, fmt.Errorf("gattering the fields for COMMENT statements: %w", err)
+	}
+	table.Options = opts
+	return CraftComments(driver, table)
+}
+
+// Indexes returns a CREATE INDEX statement for each of the indexes declared
+// with tags for the type of this marshaller, sorted by index name.
+func (s *SQLMarshaller) Indexes(driver SQLDriver) ([]string, error) {
+	return s.indexes(driver, "")
+}
+
+// indexes is like Indexes but for the table in the passed schema.
+func (s *SQLMarshaller) indexes(driver SQLDriver, schema string) ([]string, error) {
+	indexes, err := s.tokenized.indexes(s.Name())
 	if err != nil {
-		return "", fmt.Errorf("gattering the fields for CREATE statement: %v", err)
+		return nil, fmt.Errorf("gattering the indexes: %w", err)
 	}
-	return CraftCreate(driver, s.Name(), fields, fks, pks)
+	return CraftIndexes(driver, qualifiedIndexes(schema, indexes)), nil
+}
+
+// CreateDeferred returns a SQL CREATE statement without Foreign Keys for the
+// type of this marshaller and an ALTER TABLE statement adding each of them,
+// this allows creating tables that reference each other by running all the
+// CREATE statements before the ALTER TABLE ones.
+func (s *SQLMarshaller) CreateDeferred(driver SQLDriver) (string, []string, error) {
+	return s.createDeferred(driver, CreateOptions{})
+}
+
+// createDeferred is like CreateDeferred but with the passed options.
+func (s *SQLMarshaller) createDeferred(driver SQLDriver, opts CreateOptions) (string, []string, error) {
+	table, err := s.tokenized.tableDefinition(s.Name(), s.namer)
+	if err != nil {
+		return "", nil, fmt.Errorf("gattering the fields for CREATE statement: %w", err)
+	}
+	table.Options = opts
+	alters := CraftAddFKs(driver, table)
+	table.FKs = nil
+	create, err := CraftCreate(driver, table)
+	if err != nil {
+		return "", nil, err
+	}
+	return create, alters, nil
+}
+
+// Drop returns a SQL DROP statement for the table of this marshaller with
+// the passed options or error if the driver cannot express them.
+func (s *SQLMarshaller) Drop(driver SQLDriver, opts DropOptions) (string, error) {
+	return CraftDrop(driver, s.Name(), opts)
+}
+
+// Truncate returns a SQL statement removing all the rows of the table of
+// this marshaller with the passed options or error if the driver cannot
+// express them.
+func (s *SQLMarshaller) Truncate(driver SQLDriver, opts TruncateOptions) (string, error) {
+	return CraftTruncate(driver, s.Name(), opts)
 }
 
 // Insert returns a SQL INSERT statements for the passed object or
 // error if it cannot process the passed object.
 // If there are Fields which are structs or pointers to structs
-// it will consider them Foreign Keys up to only one level of
-// indirection.
+// it will consider them Foreign Keys and insert the values of the
+// primary key of the referenced object, but not the object itself,
+// see InsertGraph.
 func (s *SQLMarshaller) Insert(in interface{}) (string, error) {
-	fields, err := s.tokenized.fieldsAndValues(in)
+	fields, err := s.insertFields(s.tokenized, reflect.ValueOf(in))
 	if err != nil {
-		return "", fmt.Errorf("crafting the fields/values for INSERT statement: %v", err)
+		return "", err
+	}
+	return CraftInsert(s.Name(), fields), nil
+}
+
+// insertFields returns the fields and values to be inserted for the passed
+// value of the tokenized type t.
+func (s *SQLMarshaller) insertFields(t *tokenized, in reflect.Value) (*FieldsWithValue, error) {
+	fields, err := t.valuesOf(in)
+	if err != nil {
+		return nil, fmt.Errorf("crafting the fields/values for INSERT statement: %w", err)
 	}
 
 	if fields.Len() == 0 {
-		return "", fmt.Errorf("could not determine fields and values to insert, the resulting query would be invalid")
+		return nil, fmt.Errorf("could not determine fields and values to insert, the resulting query would be invalid")
 	}
-	return CraftInsert(s.Name(), fields), nil
+	if v, ok := t.version(); ok {
+		fields.Set(FieldWithValue{Name: v.name, Value: "1"})
+	}
+	created, updated := t.timestamps()
+	for _, name := range []string{created, updated} {
+		if name != "" {
+			fields.Set(FieldWithValue{Name: name, Value: s.now()})
+		}
+	}
+	return fields, nil
+}
+
+// InsertGraph returns the SQL INSERT statements for the passed object and
+// all the objects it references through Foreign Keys, directly or not,
+// ordered so referenced rows are inserted before the ones referencing them.
+// Objects referenced more than once are inserted only once, nil references
+// are skipped.
+// Cyclic references can't be ordered, the tables involved must be created
+// with deferred Foreign Keys, see CreateDeferred.
+func (s *SQLMarshaller) InsertGraph(in interface{}) ([]string, error) {
+	g := &insertGraph{marshaller: s, seen: map[string]bool{}}
+	if err := g.walk(s.tokenized, s.Name(), reflect.ValueOf(in), nil); err != nil {
+		return nil, err
+	}
+	return g.statements, nil
+}
+
+// insertGraph holds the state of an InsertGraph traversal.
+type insertGraph struct {
+	marshaller *SQLMarshaller
+	seen       map[string]bool
+	statements []string
+}
+
+// walk adds the INSERT statements for the objects referenced by v, then
+// the one for v itself, with the backref fields if any, unless it was
+// already inserted and finally the ones for the objects v has many of.
+func (g *insertGraph) walk(t *tokenized, table string, v reflect.Value, backref *FieldsWithValue) error {
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	fields, err := g.marshaller.insertFields(t, v)
+	if err != nil {
+		return fmt.Errorf("inserting %q: %w", table, err)
+	}
+	if backref != nil {
+		if err := fields.Append(backref); err != nil {
+			return fmt.Errorf("inserting %q: %w", table, err)
+		}
+	}
+	pks, err := t.primary()
+	if err != nil {
+		return err
+	}
+	// rows are identified by their pk or, lacking one, by all their values.
+	identity := fields
+	if len(pks) != 0 {
+		identity = NewFieldsWithValue()
+		for _, pk := range pks {
+			if f, ok := fields.Get(pk); ok {
+				identity.Add(f)
+			}
+		}
+	}
+	key := fmt.Sprintf("%s(%s)", table, strings.Join(identity.Pairs("="), ", "))
+	if g.seen[key] {
+		return nil
+	}
+	g.seen[key] = true
+
+	for _, f := range t.fields {
+		if f.kind != SqlFK {
+			continue
+		}
+		remote := v.FieldByName(f.field)
+		if remote.Kind() == reflect.Ptr && remote.IsNil() {
+			continue
+		}
+		if err := g.walk(f.references, f.references.name, remote, nil); err != nil {
+			return err
+		}
+	}
+	g.statements = append(g.statements, CraftInsert(table, fields))
+
+	for _, f := range t.fields {
+		if f.kind == SqlManyToMany {
+			if err := g.link(t, f, v); err != nil {
+				return err
+			}
+			continue
+		}
+		if f.kind != SqlHasMany {
+			continue
+		}
+		backref, err := t.primaryFieldsAndValuess(f.backref, v)
+		if err != nil {
+			return fmt.Errorf("crafting back reference for %q: %w", f.name, err)
+		}
+		elems := v.FieldByName(f.field)
+		for i := 0; i < elems.Len(); i++ {
+			elem := elems.Index(i)
+			if elem.Kind() == reflect.Ptr && elem.IsNil() {
+				continue
+			}
+			if err := g.walk(f.many, f.many.name, elem, backref); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// link adds the INSERT statements for the elements of the many to many
+// field f of v, followed by the ones for the rows linking them to v.
+func (g *insertGraph) link(t *tokenized, f tokenizedField, v reflect.Value) error {
+	elems := v.FieldByName(f.field)
+	for i := 0; i < elems.Len(); i++ {
+		elem := elems.Index(i)
+		if elem.Kind() == reflect.Ptr && elem.IsNil() {
+			continue
+		}
+		if err := g.walk(f.many, f.many.name, elem, nil); err != nil {
+			return err
+		}
+	}
+	links, err := t.links(f, v)
+	if err != nil {
+		return fmt.Errorf("crafting links for %q: %w", f.name, err)
+	}
+	for _, l := range links {
+		key := fmt.Sprintf("%s(%s)", f.joinTable, strings.Join(l.Pairs("="), ", "))
+		if g.seen[key] {
+			continue
+		}
+		g.seen[key] = true
+		g.statements = append(g.statements, CraftInsert(f.joinTable, l))
+	}
+	return nil
+}
+
+// JoinTables returns a SQL CREATE statement for the join table of each of
+// the many to many fields of the type of this marshaller, those have a
+// composite primary key made of Foreign Keys to both sides.
+func (s *SQLMarshaller) JoinTables(driver SQLDriver) ([]string, error) {
+	creates := []string{}
+	for _, f := range s.tokenized.fields {
+		if f.kind != SqlManyToMany {
+			continue
+		}
+		join, _, _ := s.tokenized.joinTableOf(f)
+		table, err := join.tableDefinition(f.joinTable, s.namer)
+		if err != nil {
+			return nil, fmt.Errorf("gattering the fields for join table %q: %w", f.joinTable, err)
+		}
+		create, err := CraftCreate(driver, table)
+		if err != nil {
+			return nil, err
+		}
+		creates = append(creates, create)
+	}
+	return creates, nil
+}
+
+// Link returns a SQL INSERT statement for each of the rows of the join table
+// linking the passed struct with the elements of its many to many field.
+func (s *SQLMarshaller) Link(in interface{}, field string) ([]string, error) {
+	f, ok := s.tokenized.manyToMany(field)
+	if !ok {
+		return nil, fmt.Errorf("%q has no many to many field %q", s.Name(), field)
+	}
+	links, err := s.tokenized.links(f, reflect.ValueOf(in))
+	if err != nil {
+		return nil, fmt.Errorf("crafting links for %q: %w", field, err)
+	}
+	inserts := make([]string, len(links))
+	for i, l := range links {
+		inserts[i] = CraftInsert(f.joinTable, l)
+	}
+	return inserts, nil
+}
+
+// Unlink returns a SQL DELETE statement for each of the rows of the join
+// table linking the passed struct with the elements of its many to many
+// field.
+func (s *SQLMarshaller) Unlink(in interface{}, field string) ([]string, error) {
+	f, ok := s.tokenized.manyToMany(field)
+	if !ok {
+		return nil, fmt.Errorf("%q has no many to many field %q", s.Name(), field)
+	}
+	links, err := s.tokenized.links(f, reflect.ValueOf(in))
+	if err != nil {
+		return nil, fmt.Errorf("crafting links for %q: %w", field, err)
+	}
+	deletes := make([]string, len(links))
+	for i, l := range links {
+		deletes[i] = CraftDelete(f.joinTable, l)
+	}
+	return deletes, nil
+}
+
+// UnlinkAll returns a SQL DELETE statement for all the rows of the join
+// table of the many to many field that link the passed struct, regardless
+// of the elements the field holds.
+func (s *SQLMarshaller) UnlinkAll(in interface{}, field string) (string, error) {
+	f, ok := s.tokenized.manyToMany(field)
+	if !ok {
+		return "", fmt.Errorf("%q has no many to many field %q", s.Name(), field)
+	}
+	_, local, _ := s.tokenized.joinTableOf(f)
+	v := reflect.ValueOf(in)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	conditions, err := s.tokenized.primaryFieldsAndValuess(local, v)
+	if err != nil {
+		return "", fmt.Errorf("crafting links for %q: %w", field, err)
+	}
+	return CraftDelete(f.joinTable, conditions), nil
+}
+
+// Children returns a marshaller for the type of the elements of each has many
+// field, in the order the fields are declared. Their CREATE statements hold
+// the Foreign Key back to the type of this marshaller.
+func (s *SQLMarshaller) Children() []*SQLMarshaller {
+	children := []*SQLMarshaller{}
+	for _, f := range s.tokenized.fields {
+		if f.kind != SqlHasMany {
+			continue
+		}
+		children = append(children, &SQLMarshaller{
+			typeOf:    f.elemType,
+			tokenized: f.many,
+			driver:    s.driver,
+			clock:     s.clock,
+			namer:     s.namer,
+		})
+	}
+	return children
 }
 
 // NewTypeSQLMarshaller returns a marshaller for the type of the passed
-// object, if it is not a struct it will fail.
+// object, if it is not a struct, a map or a yaml.MapSlice, see TokenizeMap,
+// it will fail. Malformed maps fail with a *MapSchemaError.
+// Structs named after their type are tokenized only once, see For.
 func NewTypeSQLMarshaller(in interface{}, name string) (*SQLMarshaller, error) {
 	t := reflect.TypeOf(in)
 
@@ -72,16 +515,17 @@ func NewTypeSQLMarshaller(in interface{}, name string) (*SQLMarshaller, error) {
 	var tokens *tokenized
 
 	switch t.Kind() {
-	case reflect.Map:
+	case reflect.Map, reflect.Slice:
 		{
-			tokens, err = TokenizeMap(in.(map[interface{}]interface{}), name)
+			tokens, err = tokenizeMap(in, name)
 		}
 	case reflect.Struct:
 		{
-			if name == "" {
-				name = t.Name()
+			if name == "" || name == t.Name() {
+				tokens, err = cachedTokenizeType(t)
+			} else {
+				tokens, err = TokenizeType(t, name)
 			}
-			tokens, err = TokenizeType(t, name)
 		}
 	default:
 		{
@@ -90,9 +534,14 @@ func NewTypeSQLMarshaller(in interface{}, name string) (*SQLMarshaller, error) {
 	}
 
 	if err != nil {
-		return nil, fmt.Errorf("creating a marshaller: %v", err)
+		return nil, fmt.Errorf("creating a marshaller: %w", err)
 	}
 
-	return &SQLMarshaller{typeOf: t, tokenized: tokens}, nil
+	return &SQLMarshaller{
+		typeOf:    t,
+		tokenized: tokens,
+		driver:    &ANSISQLDriver{},
+		namer:     DefaultConstraintNamer,
+	}, nil
 
 }
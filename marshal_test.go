@@ -3,10 +3,20 @@
 package sqlmarshal
 
 import (
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	_ "github.com/mattn/go-sqlite3"
 	goyaml "gopkg.in/yaml.v2"
 )
 
@@ -77,7 +87,7 @@ func TestTagged(t *testing.T) {
 		t.Errorf("cannot marshall to CREATE statement: %v", err)
 	}
 	t.Log(c)
-	expectedSQL := `CREATE TABLE dumbStruct (testInt SMALLINT, testString VARCHAR, testFloat FLOAT, testPtr_aField_fk SMALLINT, testStruct_aField_fk SMALLINT, FOREIGN KEY (testPtr_aField_fk) REFERENCES dumbFK (aField) ON DELETE CASCADE ON UPDATE CASCADE, FOREIGN KEY (testStruct_aField_fk) REFERENCES dumbFK (aField) ON DELETE CASCADE ON UPDATE CASCADE, PRIMARY KEY (testInt));`
+	expectedSQL := `CREATE TABLE dumbStruct (testInt SMALLINT, testString VARCHAR, testFloat FLOAT, testPtr_aField_fk SMALLINT, testStruct_aField_fk SMALLINT, CONSTRAINT fk_dumbStruct_testPtr_aField_fk FOREIGN KEY (testPtr_aField_fk) REFERENCES dumbFK (aField) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT fk_dumbStruct_testStruct_aField_fk FOREIGN KEY (testStruct_aField_fk) REFERENCES dumbFK (aField) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_dumbStruct PRIMARY KEY (testInt));`
 	if c != expectedSQL {
 		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
 	}
@@ -131,7 +141,7 @@ func TestTaggedMultiPK(t *testing.T) {
 		t.Errorf("cannot marshall to CREATE statement: %v", err)
 	}
 	t.Log(c)
-	expectedSQL := `CREATE TABLE dumbStructMulti (testInt SMALLINT, testString VARCHAR, testFloat FLOAT, testPtr_aField_fk SMALLINT, testPtr_aField2_fk SMALLINT, testStruct_aField_fk SMALLINT, testStruct_aField2_fk SMALLINT, FOREIGN KEY (testPtr_aField_fk, testPtr_aField2_fk) REFERENCES dumbFKMulti (aField, aField2) ON DELETE CASCADE ON UPDATE CASCADE, FOREIGN KEY (testStruct_aField_fk, testStruct_aField2_fk) REFERENCES dumbFKMulti (aField, aField2) ON DELETE CASCADE ON UPDATE CASCADE, PRIMARY KEY (testInt));`
+	expectedSQL := `CREATE TABLE dumbStructMulti (testInt SMALLINT, testString VARCHAR, testFloat FLOAT, testPtr_aField_fk SMALLINT, testPtr_aField2_fk SMALLINT, testStruct_aField_fk SMALLINT, testStruct_aField2_fk SMALLINT, CONSTRAINT fk_dumbStructMulti_testPtr_aField_fk_testPtr_aField2_fk FOREIGN KEY (testPtr_aField_fk, testPtr_aField2_fk) REFERENCES dumbFKMulti (aField, aField2) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT fk_dumbStructMulti_testStruct_aField_fk_testStruct_aField2_fk FOREIGN KEY (testStruct_aField_fk, testStruct_aField2_fk) REFERENCES dumbFKMulti (aField, aField2) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_dumbStructMulti PRIMARY KEY (testInt));`
 	if c != expectedSQL {
 		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
 	}
@@ -166,7 +176,7 @@ func TestTaggedMultiPK(t *testing.T) {
 		t.Errorf("cannot marshall to CREATE statement: %v", err)
 	}
 	t.Log(c)
-	expectedSQL = `CREATE TABLE dumbFKMulti (aField SMALLINT, aField2 SMALLINT, anotherField VARCHAR, PRIMARY KEY (aField ,aField2));`
+	expectedSQL = `CREATE TABLE dumbFKMulti (aField SMALLINT, aField2 SMALLINT, anotherField VARCHAR, CONSTRAINT pk_dumbFKMulti PRIMARY KEY (aField ,aField2));`
 	if c != expectedSQL {
 		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
 	}
@@ -207,7 +217,7 @@ func TestUnTagged(t *testing.T) {
 		t.Errorf("cannot marshall to CREATE statement: %v", err)
 	}
 	t.Log(c)
-	expectedSQL := `CREATE TABLE untaggedDumbStruct (testInt SMALLINT, testString VARCHAR, testFloat FLOAT, testPtr INT, testStruct INT, FOREIGN KEY (testPtr) REFERENCES untaggedDumbFK (_ID) ON DELETE CASCADE ON UPDATE CASCADE, FOREIGN KEY (testStruct) REFERENCES untaggedDumbFK (_ID) ON DELETE CASCADE ON UPDATE CASCADE);`
+	expectedSQL := `CREATE TABLE untaggedDumbStruct (testInt SMALLINT, testString VARCHAR, testFloat FLOAT, testPtr INT, testStruct INT, CONSTRAINT fk_untaggedDumbStruct_testPtr FOREIGN KEY (testPtr) REFERENCES untaggedDumbFK (_ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT fk_untaggedDumbStruct_testStruct FOREIGN KEY (testStruct) REFERENCES untaggedDumbFK (_ID) ON DELETE CASCADE ON UPDATE CASCADE);`
 	if c != expectedSQL {
 		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
 	}
@@ -261,7 +271,7 @@ func TestDocSampleCreate(t *testing.T) {
 		t.Errorf("could not run documentation sample for CREATE: %v", err)
 	}
 	t.Log(c)
-	expectedSQL := `CREATE TABLE Sample (ID SMALLINT, Name VARCHAR, Reference_DifferentNameID_fk SMALLINT, ConcreteReference_DifferentNameID_fk SMALLINT, FOREIGN KEY (Reference_DifferentNameID_fk) REFERENCES Reference (DifferentNameID) ON DELETE CASCADE ON UPDATE CASCADE, FOREIGN KEY (ConcreteReference_DifferentNameID_fk) REFERENCES Reference (DifferentNameID) ON DELETE CASCADE ON UPDATE CASCADE, PRIMARY KEY (ID));`
+	expectedSQL := `CREATE TABLE Sample (ID SMALLINT, Name VARCHAR, Reference_DifferentNameID_fk SMALLINT, ConcreteReference_DifferentNameID_fk SMALLINT, CONSTRAINT fk_Sample_Reference_DifferentNameID_fk FOREIGN KEY (Reference_DifferentNameID_fk) REFERENCES Reference (DifferentNameID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT fk_Sample_ConcreteReference_DifferentNameID_fk FOREIGN KEY (ConcreteReference_DifferentNameID_fk) REFERENCES Reference (DifferentNameID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_Sample PRIMARY KEY (ID));`
 	if c != expectedSQL {
 		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
 	}
@@ -382,7 +392,7 @@ tables:
 )
 
 type DatabaseSchema struct {
-	Tables map[string]map[string]interface{}
+	Tables goyaml.MapSlice
 }
 
 func TestCreateFromYAML(t *testing.T) {
@@ -394,8 +404,13 @@ func TestCreateFromYAML(t *testing.T) {
 	}
 
 	var obtained []string
-	for table_name, table := range schema.Tables {
-		if fields, ok := table["fields"]; ok {
+	for _, table := range schema.Tables {
+		table_name := table.Key.(string)
+		for _, item := range table.Value.(goyaml.MapSlice) {
+			if item.Key != "fields" {
+				continue
+			}
+			fields := item.Value
 			m, err := NewTypeSQLMarshaller(fields, table_name)
 			if err != nil {
 				t.Errorf("Cannot create marshaller: %v", err)
@@ -412,8 +427,8 @@ func TestCreateFromYAML(t *testing.T) {
 	}
 
 	expected := []string{
-		"CREATE TABLE humans (id SMALLINT, created SMALLINT, PRIMARY KEY (id));",
-		"CREATE TABLE mamals (id SMALLINT, created VARCHAR);",
+		"CREATE TABLE humans (id SMALLINT, created SMALLINT, CONSTRAINT pk_humans PRIMARY KEY (id), CONSTRAINT uq_humans_id UNIQUE (id));",
+		"CREATE TABLE mamals (id SMALLINT, created VARCHAR, CONSTRAINT uq_mamals_created UNIQUE (created));",
 	}
 
 	if !reflect.DeepEqual(obtained, expected) {
@@ -422,3 +437,2175 @@ func TestCreateFromYAML(t *testing.T) {
 
 	t.Log(obtained)
 }
+
+func TestMapOrder(t *testing.T) {
+	var fields map[interface{}]interface{}
+	err := goyaml.Unmarshal([]byte(`
+name:
+  type: string
+id:
+  type: int
+  order: 1
+age:
+  type: int
+created:
+  type: int
+  order: 2`), &fields)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	m, err := NewTypeSQLMarshaller(fields, "people")
+	if err != nil {
+		t.Fatalf("cannot create marshaller: %v", err)
+	}
+	c, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE people (id SMALLINT, created SMALLINT, age SMALLINT, name VARCHAR);`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+}
+
+func TestMapSchemaErrors(t *testing.T) {
+	var columns map[string]interface{}
+	err := json.Unmarshal([]byte(`{"id": {"type": "int", "primary": true, "order": 1}, "name": {"type": "string", "size": 20}}`), &columns)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	m, err := NewTypeSQLMarshaller(columns, "people")
+	if err != nil {
+		t.Fatalf("cannot create marshaller: %v", err)
+	}
+	c, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE people (id SMALLINT, name VARCHAR(20), CONSTRAINT pk_people PRIMARY KEY (id));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	invalid := []struct {
+		columns  interface{}
+		expected MapSchemaError
+	}{
+		{[]string{"id"}, MapSchemaError{Table: "people"}},
+		{map[string]interface{}{"id": "int"}, MapSchemaError{Table: "people", Field: "id"}},
+		{map[string]interface{}{"id": map[string]interface{}{"primary": true}}, MapSchemaError{Table: "people", Field: "id", Key: "type"}},
+		{map[string]interface{}{"id": map[string]interface{}{"type": "int", "primary": "yes"}}, MapSchemaError{Table: "people", Field: "id", Key: "primary"}},
+		{map[string]interface{}{"id": map[string]interface{}{"type": []interface{}{"int"}}}, MapSchemaError{Table: "people", Field: "id", Key: "type"}},
+		{map[string]interface{}{"id": map[string]interface{}{"type": "int", "order": 1.5}}, MapSchemaError{Table: "people", Field: "id", Key: "order"}},
+		{map[string]interface{}{"id": map[string]interface{}{"type": "int", "default": "none"}}, MapSchemaError{Table: "people", Field: "id", Key: "default"}},
+		{map[string]interface{}{"id": map[string]interface{}{"type": "int", "size": 10}}, MapSchemaError{Table: "people", Field: "id", Key: "size"}},
+	}
+	for _, test := range invalid {
+		_, err := NewTypeSQLMarshaller(test.columns, "people")
+		var obtained *MapSchemaError
+		if !errors.As(err, &obtained) {
+			t.Errorf("unexpected error for %v: %v", test.columns, err)
+			continue
+		}
+		if obtained.Table != test.expected.Table || obtained.Field != test.expected.Field || obtained.Key != test.expected.Key {
+			t.Errorf("unexpected error path: \nexpected: %+v\nobtained: %+v", test.expected, *obtained)
+		}
+	}
+
+	if _, err := NewTypeSQLMarshaller(sizedInt{}, ""); err == nil {
+		t.Errorf("expected an error for the size of an integer field")
+	}
+	table := TableDefinition{Name: "people", Fields: []FieldDefinition{{Name: "id", Type: SqlSmallInt, Size: 4}}}
+	if _, err := CraftCreate(&ANSISQLDriver{}, table); err == nil {
+		t.Errorf("expected an error for the size of an integer column")
+	}
+}
+
+type sizedInt struct {
+	ID int `sql:"primary,size=4"`
+}
+
+type versioned struct {
+	ID      int `sql:"primary"`
+	Name    string
+	Version int64 `sql:"version"`
+}
+
+type fakeResult struct {
+	affected int64
+}
+
+func (f fakeResult) LastInsertId() (int64, error) { return 0, nil }
+func (f fakeResult) RowsAffected() (int64, error) { return f.affected, nil }
+
+type fakeExecer struct {
+	queries  []string
+	affected int64
+}
+
+func (f *fakeExecer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	f.queries = append(f.queries, query)
+	return fakeResult{affected: f.affected}, nil
+}
+
+func TestVersion(t *testing.T) {
+	v := versioned{
+		ID:      1,
+		Name:    "a name",
+		Version: 7,
+	}
+	m, err := NewTypeSQLMarshaller(v, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+
+	c, err := m.Insert(v)
+	if err != nil {
+		t.Errorf("cannot marshall to INSERT statement: %v", err)
+	}
+	expectedSQL := `INSERT INTO versioned (ID, Name, Version) VALUES (1, "a name", 1);`
+	if c != expectedSQL {
+		t.Errorf("unexpected INSERT statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	c, err = m.UpdatePK(v)
+	if err != nil {
+		t.Errorf("cannot marshall to UPDATE statement: %v", err)
+	}
+	expectedSQL = `UPDATE versioned SET Name="a name", Version=8 WHERE ID=1 AND Version=7;`
+	if c != expectedSQL {
+		t.Errorf("unexpected UPDATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	c, err = m.UpdatePK(&v)
+	if err != nil {
+		t.Errorf("cannot marshall a pointer to UPDATE statement: %v", err)
+	}
+	if c != expectedSQL {
+		t.Errorf("unexpected UPDATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	db := &fakeExecer{affected: 1}
+	if err := m.ExecUpdatePK(db, v); err != nil {
+		t.Errorf("unexpected error updating: %v", err)
+	}
+	db.affected = 0
+	if err := m.ExecUpdatePK(db, v); err != ErrVersionConflict {
+		t.Errorf("expected %v, got %v", ErrVersionConflict, err)
+	}
+}
+
+type badVersioned struct {
+	ID      int    `sql:"primary"`
+	Version string `sql:"version"`
+}
+
+type uintVersioned struct {
+	ID      int  `sql:"primary"`
+	Version uint `sql:"version"`
+}
+
+func TestUintVersion(t *testing.T) {
+	v := uintVersioned{ID: 1, Version: 7}
+	m, err := NewTypeSQLMarshaller(v, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	c, err := m.UpdatePK(v)
+	if err != nil {
+		t.Errorf("cannot marshall to UPDATE statement: %v", err)
+	}
+	expectedSQL := `UPDATE uintVersioned SET Version=8 WHERE ID=1 AND Version=7;`
+	if c != expectedSQL {
+		t.Errorf("unexpected UPDATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+}
+
+func TestVersionMustBeInteger(t *testing.T) {
+	_, err := NewTypeSQLMarshaller(badVersioned{}, "")
+	if err == nil {
+		t.Errorf("expected an error for a non integer version field")
+	}
+}
+
+type softDeleted struct {
+	ID      int `sql:"primary"`
+	Name    *string
+	Deleted *time.Time `sql:"softdelete"`
+}
+
+type softDeletedBool struct {
+	ID      int  `sql:"primary"`
+	Deleted bool `sql:"softdelete"`
+}
+
+func TestSoftDelete(t *testing.T) {
+	deleted := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	s := softDeleted{
+		ID:      1,
+		Deleted: &deleted,
+	}
+	m, err := NewTypeSQLMarshaller(s, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+
+	c, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE softDeleted (ID SMALLINT, Name VARCHAR, Deleted TIMESTAMP, CONSTRAINT pk_softDeleted PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	c, err = m.Insert(s)
+	if err != nil {
+		t.Errorf("cannot marshall to INSERT statement: %v", err)
+	}
+	expectedSQL = `INSERT INTO softDeleted (ID, Name, Deleted) VALUES (1, NULL, "2016-05-04 03:02:01");`
+	if c != expectedSQL {
+		t.Errorf("unexpected INSERT statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	c, err = m.DeletePK(s)
+	if err != nil {
+		t.Errorf("cannot marshall to DELETE statement: %v", err)
+	}
+	expectedSQL = `UPDATE softDeleted SET Deleted=CURRENT_TIMESTAMP WHERE ID=1;`
+	if c != expectedSQL {
+		t.Errorf("unexpected DELETE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	c, err = m.Select(SelectOptions{})
+	if err != nil {
+		t.Errorf("cannot marshall to SELECT statement: %v", err)
+	}
+	expectedSQL = `SELECT ID, Name, Deleted FROM softDeleted WHERE Deleted IS NULL;`
+	if c != expectedSQL {
+		t.Errorf("unexpected SELECT statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	c, err = m.SelectPK(s, SelectOptions{IncludeDeleted: true})
+	if err != nil {
+		t.Errorf("cannot marshall to SELECT statement: %v", err)
+	}
+	expectedSQL = `SELECT ID, Name, Deleted FROM softDeleted WHERE ID=1;`
+	if c != expectedSQL {
+		t.Errorf("unexpected SELECT statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	b := softDeletedBool{ID: 2}
+	m, err = NewTypeSQLMarshaller(b, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	c, err = m.DeletePK(b)
+	if err != nil {
+		t.Errorf("cannot marshall to DELETE statement: %v", err)
+	}
+	expectedSQL = `UPDATE softDeletedBool SET Deleted=1 WHERE ID=2;`
+	if c != expectedSQL {
+		t.Errorf("unexpected DELETE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+	c, err = m.SelectPK(b, SelectOptions{})
+	if err != nil {
+		t.Errorf("cannot marshall to SELECT statement: %v", err)
+	}
+	expectedSQL = `SELECT ID, Deleted FROM softDeletedBool WHERE ID=2 AND Deleted=0;`
+	if c != expectedSQL {
+		t.Errorf("unexpected SELECT statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+}
+
+func TestHardDelete(t *testing.T) {
+	d := dumbFKMulti{aField: 3, aField2: 5}
+	m, err := NewTypeSQLMarshaller(d, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	c, err := m.DeletePK(d)
+	if err != nil {
+		t.Errorf("cannot marshall to DELETE statement: %v", err)
+	}
+	expectedSQL := `DELETE FROM dumbFKMulti WHERE aField=3 AND aField2=5;`
+	if c != expectedSQL {
+		t.Errorf("unexpected DELETE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+}
+
+type timestamped struct {
+	ID      int `sql:"primary"`
+	Name    string
+	Created time.Time `sql:"created"`
+	Updated time.Time `sql:"updated"`
+}
+
+func TestTimestamps(t *testing.T) {
+	s := timestamped{ID: 1, Name: "a name"}
+	m, err := NewTypeSQLMarshaller(s, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+
+	c, err := m.Insert(s)
+	if err != nil {
+		t.Errorf("cannot marshall to INSERT statement: %v", err)
+	}
+	expectedSQL := `INSERT INTO timestamped (ID, Name, Created, Updated) VALUES (1, "a name", CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);`
+	if c != expectedSQL {
+		t.Errorf("unexpected INSERT statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	m.SetClock(func() time.Time {
+		return time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	})
+	c, err = m.UpdatePK(s)
+	if err != nil {
+		t.Errorf("cannot marshall to UPDATE statement: %v", err)
+	}
+	expectedSQL = `UPDATE timestamped SET Name="a name", Updated="2016-05-04 03:02:01" WHERE ID=1;`
+	if c != expectedSQL {
+		t.Errorf("unexpected UPDATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+}
+
+type unexportedTime struct {
+	ID      int `sql:"primary"`
+	created time.Time
+}
+
+func TestUnexportedTime(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(unexportedTime{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	_, err = m.Insert(unexportedTime{ID: 1, created: time.Now()})
+	expectedErr := `crafting the fields/values for INSERT statement: cannot read the value of unexported field "created"`
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("unexpected error: \nexpected: %q\nobtained: %v", expectedErr, err)
+	}
+}
+
+type withDefaults struct {
+	ID      int     `sql:"primary"`
+	Name    string  `sql:"default=unnamed"`
+	Age     int     `sql:"default=18,check=Age >= 0"`
+	Score   float64 `sql:"default=1.5"`
+	Comment *string `sql:"default=NULL"`
+}
+
+func TestDefaultsAndChecks(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(withDefaults{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	c, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE withDefaults (ID SMALLINT, Name VARCHAR DEFAULT "unnamed", Age SMALLINT DEFAULT 18 CONSTRAINT ck_withDefaults_Age CHECK (Age >= 0), Score DOUBLE DEFAULT 1.500000, Comment VARCHAR DEFAULT NULL, CONSTRAINT pk_withDefaults PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+}
+
+type badDefault struct {
+	Age int `sql:"default=eighteen"`
+}
+
+func TestBadDefault(t *testing.T) {
+	_, err := NewTypeSQLMarshaller(badDefault{}, "")
+	if err == nil {
+		t.Errorf("expected an error for a default that is not an int")
+	}
+}
+
+func TestDefaultsAndChecksFromYAML(t *testing.T) {
+	var fields map[interface{}]interface{}
+	err := goyaml.Unmarshal([]byte(`
+age:
+  type: int
+  default: 18
+  check: age >= 0`), &fields)
+	if err != nil {
+		t.Fatalf("%v", err)
+	}
+	m, err := NewTypeSQLMarshaller(fields, "people")
+	if err != nil {
+		t.Fatalf("cannot create marshaller: %v", err)
+	}
+	c, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE people (age SMALLINT DEFAULT 18 CONSTRAINT ck_people_age CHECK (age >= 0));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+}
+
+type indexed struct {
+	ID        int    `sql:"primary"`
+	Email     string `sql:"uniqueindex=email_unique"`
+	FirstName string `sql:"index=full_name"`
+	LastName  string `sql:"index=full_name"`
+	Age       int    `sql:"index"`
+	Ref       *dumbFK
+}
+
+type indexedFK struct {
+	ID  int     `sql:"primary"`
+	Ref *dumbFK `sql:"index"`
+}
+
+func TestIndexes(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(indexed{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	obtained, err := m.Indexes(&ANSISQLDriver{})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE INDEX statements: %v", err)
+	}
+	expected := []string{
+		"CREATE UNIQUE INDEX email_unique ON indexed (Email);",
+		"CREATE INDEX full_name ON indexed (FirstName, LastName);",
+		"CREATE INDEX idx_indexed_Age ON indexed (Age);",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE INDEX statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	m, err = NewTypeSQLMarshaller(indexedFK{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	obtained, err = m.Indexes(&PostgreSQLDriver{})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE INDEX statements: %v", err)
+	}
+	expected = []string{
+		"CREATE INDEX idx_indexedFK_Ref ON indexedFK (Ref_aField_fk);",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE INDEX statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	obtained, err = m.Indexes(&PostgreSQLDriver{IndexIfNotExists: true, IndexMethod: "btree"})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE INDEX statements: %v", err)
+	}
+	expected = []string{
+		"CREATE INDEX IF NOT EXISTS idx_indexedFK_Ref ON indexedFK USING btree (Ref_aField_fk);",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE INDEX statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+}
+
+type audited struct {
+	ID     int     `sql:"primary"`
+	Author *dumbFK `sql:"ondelete=restrict,onupdate=noaction"`
+	Editor *dumbFK `sql:"ondelete=setnull"`
+}
+
+type defaulted struct {
+	ID     int     `sql:"primary"`
+	Author *dumbFK `sql:"ondelete=setdefault"`
+}
+
+type badAudited struct {
+	ID     int    `sql:"primary"`
+	Author dumbFK `sql:"ondelete=setnull"`
+}
+
+func TestFKActions(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(audited{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	c, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE audited (ID SMALLINT, Author_aField_fk SMALLINT, Editor_aField_fk SMALLINT, CONSTRAINT fk_audited_Author_aField_fk FOREIGN KEY (Author_aField_fk) REFERENCES dumbFK (aField) ON DELETE RESTRICT ON UPDATE NO ACTION, CONSTRAINT fk_audited_Editor_aField_fk FOREIGN KEY (Editor_aField_fk) REFERENCES dumbFK (aField) ON DELETE SET NULL ON UPDATE CASCADE, CONSTRAINT pk_audited PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	if _, err := NewTypeSQLMarshaller(badAudited{}, ""); err == nil {
+		t.Errorf("expected an error for SET NULL on a non nullable foreign key")
+	}
+
+	c, err = m.Create(&OracleSQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL = `CREATE TABLE audited (ID SMALLINT, Author_aField_fk SMALLINT, Editor_aField_fk SMALLINT, CONSTRAINT fk_audited_Author_aField_fk FOREIGN KEY (Author_aField_fk) REFERENCES dumbFK (aField), CONSTRAINT fk_audited_Editor_aField_fk FOREIGN KEY (Editor_aField_fk) REFERENCES dumbFK (aField) ON DELETE SET NULL, CONSTRAINT pk_audited PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	m, err = NewTypeSQLMarshaller(defaulted{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	if _, err := m.Create(&OracleSQLDriver{}); err == nil {
+		t.Errorf("expected an error for SET DEFAULT on delete in Oracle")
+	}
+}
+
+func TestConstraintNames(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(dumbStructMulti{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	m.SetConstraintNamer(func(kind ConstraintKind, table string, columns []string) string {
+		return fmt.Sprintf("%s_%s_%s", table, kind, columns[0])
+	})
+	c, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE dumbStructMulti (testInt SMALLINT, testString VARCHAR, testFloat FLOAT, testPtr_aField_fk SMALLINT, testPtr_aField2_fk SMALLINT, testStruct_aField_fk SMALLINT, testStruct_aField2_fk SMALLINT, CONSTRAINT dumbStructMulti_fk_testPtr_aField_fk FOREIGN KEY (testPtr_aField_fk, testPtr_aField2_fk) REFERENCES dumbFKMulti (aField, aField2) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT dumbStructMulti_fk_testStruct_aField_fk FOREIGN KEY (testStruct_aField_fk, testStruct_aField2_fk) REFERENCES dumbFKMulti (aField, aField2) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT dumbStructMulti_pk_testInt PRIMARY KEY (testInt));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+	if err := m.Validate(&ANSISQLDriver{}); err != nil {
+		t.Errorf("unexpected validation error: %v", err)
+	}
+
+	m.SetConstraintNamer(func(kind ConstraintKind, table string, columns []string) string {
+		return fmt.Sprintf("%s_%s_%d", table, kind, len(columns))
+	})
+	expectedErr := `invalid schema: table "dumbStructMulti": constraint name "dumbStructMulti_fk_2" is used more than once`
+	if err := m.Validate(&ANSISQLDriver{}); err == nil || err.Error() != expectedErr {
+		t.Errorf("unexpected validation error: \nexpected: %q\nobtained: %v", expectedErr, err)
+	}
+}
+
+func TestTruncateIdentifier(t *testing.T) {
+	long := "fk_dumbStructMulti_testStruct_aField_fk_testStruct_aField2_fk"
+	for _, max := range []int{30, 63} {
+		truncated := truncateIdentifier(long, max)
+		if len(truncated) > max {
+			t.Errorf("identifier %q is longer than %d", truncated, max)
+		}
+	}
+	if truncateIdentifier(long, 30) == truncateIdentifier(long+"_other", 30) {
+		t.Errorf("truncated identifiers sharing a prefix collide")
+	}
+	if truncateIdentifier(long, 0) != long {
+		t.Errorf("identifier truncated with no limit")
+	}
+
+	m, err := NewTypeSQLMarshaller(dumbStructMulti{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	c, err := m.Create(&OracleSQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	if strings.Contains(c, long) {
+		t.Errorf("constraint name was not truncated: %q", c)
+	}
+
+	index := IndexDefinition{Name: long, Table: "dumbStructMulti", Columns: []string{"testInt"}}
+	indexes := CraftIndexes(&OracleSQLDriver{}, []IndexDefinition{index})
+	expected := fmt.Sprintf("CREATE INDEX %s ON dumbStructMulti (testInt);", truncateIdentifier(long, 30))
+	if indexes[0] != expected {
+		t.Errorf("unexpected CREATE INDEX statement: \nexpected: %q\nobtained: %q", expected, indexes[0])
+	}
+}
+
+type node struct {
+	ID     int `sql:"primary"`
+	Parent *node
+}
+
+type employee struct {
+	ID         int `sql:"primary"`
+	Department *department
+}
+
+type department struct {
+	ID      int `sql:"primary"`
+	Manager *employee
+}
+
+func TestSelfReference(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(node{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	c, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE node (ID SMALLINT, Parent_ID_fk SMALLINT, CONSTRAINT fk_node_Parent_ID_fk FOREIGN KEY (Parent_ID_fk) REFERENCES node (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_node PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	n := node{ID: 2, Parent: &node{ID: 1}}
+	c, err = m.Insert(n)
+	if err != nil {
+		t.Errorf("cannot marshall to INSERT statement: %v", err)
+	}
+	expectedSQL = `INSERT INTO node (ID, Parent_ID_fk) VALUES (2, 1);`
+	if c != expectedSQL {
+		t.Errorf("unexpected INSERT statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+}
+
+func TestCyclicReference(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(employee{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	c, alters, err := m.CreateDeferred(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE employee (ID SMALLINT, Department_ID_fk SMALLINT, CONSTRAINT pk_employee PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+	expected := []string{
+		"ALTER TABLE employee ADD CONSTRAINT fk_employee_Department_ID_fk FOREIGN KEY (Department_ID_fk) REFERENCES department (ID) ON DELETE CASCADE ON UPDATE CASCADE;",
+	}
+	if !reflect.DeepEqual(alters, expected) {
+		t.Errorf("unexpected ALTER TABLE statements: \nexpected: %q\nobtained: %q", expected, alters)
+	}
+}
+
+type customer struct {
+	ID   int `sql:"primary"`
+	Name string
+}
+
+type order struct {
+	Number   int       `sql:"primary"`
+	Customer *customer `sql:"primary"`
+}
+
+type orderLine struct {
+	Line    int    `sql:"primary"`
+	Order   *order `sql:"primary"`
+	Product string
+	Buyer   *customer
+}
+
+func TestInsertGraph(t *testing.T) {
+	c := &customer{ID: 7, Name: "a customer"}
+	l := orderLine{
+		Line:    1,
+		Order:   &order{Number: 3, Customer: c},
+		Product: "a product",
+		Buyer:   c,
+	}
+	m, err := NewTypeSQLMarshaller(l, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+
+	create, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE orderLine (Line SMALLINT, Order_Number_fk SMALLINT, Order_Customer_ID_fk_fk SMALLINT, Product VARCHAR, Buyer_ID_fk SMALLINT, CONSTRAINT fk_orderLine_Order_Number_fk_Order_Customer_ID_fk_fk FOREIGN KEY (Order_Number_fk, Order_Customer_ID_fk_fk) REFERENCES order (Number, Customer_ID_fk) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT fk_orderLine_Buyer_ID_fk FOREIGN KEY (Buyer_ID_fk) REFERENCES customer (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_orderLine PRIMARY KEY (Line ,Order_Number_fk ,Order_Customer_ID_fk_fk));`
+	if create != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, create)
+	}
+
+	obtained, err := m.InsertGraph(l)
+	if err != nil {
+		t.Fatalf("cannot marshall to INSERT statements: %v", err)
+	}
+	expected := []string{
+		`INSERT INTO customer (ID, Name) VALUES (7, "a customer");`,
+		`INSERT INTO order (Number, Customer_ID_fk) VALUES (3, 7);`,
+		`INSERT INTO orderLine (Line, Order_Number_fk, Order_Customer_ID_fk_fk, Product, Buyer_ID_fk) VALUES (1, 3, 7, "a product", 7);`,
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected INSERT statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	update, err := m.UpdatePK(l)
+	if err != nil {
+		t.Errorf("cannot marshall to UPDATE statement: %v", err)
+	}
+	expectedSQL = `UPDATE orderLine SET Product="a product", Buyer_ID_fk=7 WHERE Line=1 AND Order_Number_fk=3 AND Order_Customer_ID_fk_fk=7;`
+	if update != expectedSQL {
+		t.Errorf("unexpected UPDATE statement: \nexpected: %q\nobtained: %q", expectedSQL, update)
+	}
+}
+
+type Post struct {
+	ID       int `sql:"primary"`
+	Title    string
+	Comments []*Comment `sql:"backref=Parent"`
+	Authors  []Author
+}
+
+type Comment struct {
+	ID   int `sql:"primary"`
+	Body string
+}
+
+type Author struct {
+	Name string `sql:"primary"`
+}
+
+// fakeRows implements Rows returning the held rows.
+type fakeRows struct {
+	rows [][]interface{}
+	next int
+}
+
+func (f *fakeRows) Next() bool {
+	f.next++
+	return f.next <= len(f.rows)
+}
+
+func (f *fakeRows) Scan(dest ...interface{}) error {
+	row := f.rows[f.next-1]
+	if len(dest) != len(row) {
+		return fmt.Errorf("expected %d destinations, got %d", len(row), len(dest))
+	}
+	for i := range dest {
+		*(dest[i].(*interface{})) = row[i]
+	}
+	return nil
+}
+
+func (f *fakeRows) Err() error { return nil }
+
+func TestHasMany(t *testing.T) {
+	p := Post{
+		ID:       1,
+		Title:    "a title",
+		Comments: []*Comment{{ID: 2, Body: "first"}, {ID: 3, Body: "second"}},
+		Authors:  []Author{{Name: "someone"}},
+	}
+	m, err := NewTypeSQLMarshaller(p, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	dr := &ANSISQLDriver{}
+
+	var obtained []string
+	for _, child := range append([]*SQLMarshaller{m}, m.Children()...) {
+		c, err := child.Create(dr)
+		if err != nil {
+			t.Fatalf("cannot marshall to CREATE statement: %v", err)
+		}
+		obtained = append(obtained, c)
+	}
+	expected := []string{
+		"CREATE TABLE Post (ID SMALLINT, Title VARCHAR, CONSTRAINT pk_Post PRIMARY KEY (ID));",
+		"CREATE TABLE Comment (ID SMALLINT, Body VARCHAR, Parent_ID_fk SMALLINT, CONSTRAINT fk_Comment_Parent_ID_fk FOREIGN KEY (Parent_ID_fk) REFERENCES Post (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_Comment PRIMARY KEY (ID));",
+		"CREATE TABLE Author (Name VARCHAR, Post_ID_fk SMALLINT, CONSTRAINT fk_Author_Post_ID_fk FOREIGN KEY (Post_ID_fk) REFERENCES Post (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_Author PRIMARY KEY (Name));",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	obtained, err = m.InsertGraph(p)
+	if err != nil {
+		t.Fatalf("cannot marshall to INSERT statements: %v", err)
+	}
+	expected = []string{
+		`INSERT INTO Post (ID, Title) VALUES (1, "a title");`,
+		`INSERT INTO Comment (ID, Body, Parent_ID_fk) VALUES (2, "first", 1);`,
+		`INSERT INTO Comment (ID, Body, Parent_ID_fk) VALUES (3, "second", 1);`,
+		`INSERT INTO Author (Name, Post_ID_fk) VALUES ("someone", 1);`,
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected INSERT statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	c, err := m.SelectChildren(p, "Comments", SelectOptions{})
+	if err != nil {
+		t.Fatalf("cannot marshall to SELECT statement: %v", err)
+	}
+	expectedSQL := `SELECT ID, Body, Parent_ID_fk FROM Comment WHERE Parent_ID_fk=1;`
+	if c != expectedSQL {
+		t.Errorf("unexpected SELECT statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	var loaded Post
+	err = m.Scan(&fakeRows{rows: [][]interface{}{{int64(1), []byte("a title")}}, next: 1}, &loaded)
+	if err != nil {
+		t.Fatalf("cannot scan: %v", err)
+	}
+	rows := &fakeRows{rows: [][]interface{}{
+		{int64(2), "first", int64(1)},
+		{int64(3), "second", int64(1)},
+	}}
+	if err := m.ScanChildren(rows, &loaded, "Comments"); err != nil {
+		t.Fatalf("cannot scan children: %v", err)
+	}
+	p.Authors = nil
+	if !reflect.DeepEqual(loaded, p) {
+		t.Errorf("unexpected scanned value: \nexpected: %#v\nobtained: %#v", p, loaded)
+	}
+}
+
+type Article struct {
+	ID      int        `sql:"primary"`
+	Tags    []Tag      `sql:"m2m=article_tags"`
+	Related []*Article `sql:"m2m=related_articles"`
+}
+
+type Tag struct {
+	Name string `sql:"primary"`
+}
+
+func TestManyToMany(t *testing.T) {
+	a := Article{
+		ID:      1,
+		Tags:    []Tag{{Name: "go"}, {Name: "sql"}},
+		Related: []*Article{{ID: 2}},
+	}
+	m, err := NewTypeSQLMarshaller(a, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	dr := &ANSISQLDriver{}
+
+	c, err := m.Create(dr)
+	if err != nil {
+		t.Errorf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TABLE Article (ID SMALLINT, CONSTRAINT pk_Article PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	obtained, err := m.JoinTables(dr)
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	expected := []string{
+		"CREATE TABLE article_tags (Article_ID_fk SMALLINT, Tag_Name_fk VARCHAR, CONSTRAINT fk_article_tags_Article_ID_fk FOREIGN KEY (Article_ID_fk) REFERENCES Article (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT fk_article_tags_Tag_Name_fk FOREIGN KEY (Tag_Name_fk) REFERENCES Tag (Name) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_article_tags PRIMARY KEY (Article_ID_fk ,Tag_Name_fk));",
+		"CREATE TABLE related_articles (Article_ID_fk SMALLINT, Related_ID_fk SMALLINT, CONSTRAINT fk_related_articles_Article_ID_fk FOREIGN KEY (Article_ID_fk) REFERENCES Article (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT fk_related_articles_Related_ID_fk FOREIGN KEY (Related_ID_fk) REFERENCES Article (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_related_articles PRIMARY KEY (Article_ID_fk ,Related_ID_fk));",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	obtained, err = m.Link(a, "Tags")
+	if err != nil {
+		t.Fatalf("cannot marshall to INSERT statements: %v", err)
+	}
+	expected = []string{
+		`INSERT INTO article_tags (Article_ID_fk, Tag_Name_fk) VALUES (1, "go");`,
+		`INSERT INTO article_tags (Article_ID_fk, Tag_Name_fk) VALUES (1, "sql");`,
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected INSERT statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	obtained, err = m.Unlink(a, "Related")
+	if err != nil {
+		t.Fatalf("cannot marshall to DELETE statements: %v", err)
+	}
+	expected = []string{
+		`DELETE FROM related_articles WHERE Article_ID_fk=1 AND Related_ID_fk=2;`,
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected DELETE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	c, err = m.UnlinkAll(a, "Tags")
+	if err != nil {
+		t.Fatalf("cannot marshall to DELETE statement: %v", err)
+	}
+	expectedSQL = `DELETE FROM article_tags WHERE Article_ID_fk=1;`
+	if c != expectedSQL {
+		t.Errorf("unexpected DELETE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	obtained, err = m.InsertGraph(a)
+	if err != nil {
+		t.Fatalf("cannot marshall to INSERT statements: %v", err)
+	}
+	expected = []string{
+		`INSERT INTO Article (ID) VALUES (1);`,
+		`INSERT INTO Tag (Name) VALUES ("go");`,
+		`INSERT INTO Tag (Name) VALUES ("sql");`,
+		`INSERT INTO article_tags (Article_ID_fk, Tag_Name_fk) VALUES (1, "go");`,
+		`INSERT INTO article_tags (Article_ID_fk, Tag_Name_fk) VALUES (1, "sql");`,
+		`INSERT INTO Article (ID) VALUES (2);`,
+		`INSERT INTO related_articles (Article_ID_fk, Related_ID_fk) VALUES (1, 2);`,
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected INSERT statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+}
+
+func TestSchema(t *testing.T) {
+	s := NewSchema()
+	for _, in := range []interface{}{orderLine{}, order{}, customer{}, Tag{}, Article{}, node{}} {
+		if _, err := s.Register(in, ""); err != nil {
+			t.Fatalf("cannot register %T: %v", in, err)
+		}
+	}
+	if _, err := s.Register(customer{}, ""); err == nil {
+		t.Errorf("expected an error registering a table twice")
+	}
+	dr := &ANSISQLDriver{}
+
+	obtained, err := s.Create(dr)
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	tables := []string{}
+	for _, c := range obtained {
+		tables = append(tables, strings.Fields(c)[2])
+	}
+	expected := []string{"customer", "order", "orderLine", "Tag", "Article", "node", "article_tags", "related_articles"}
+	if !reflect.DeepEqual(tables, expected) {
+		t.Errorf("unexpected CREATE order: \nexpected: %q\nobtained: %q", expected, tables)
+	}
+
+	obtained, err = s.Drop(dr, DropOptions{})
+	if err != nil {
+		t.Fatalf("cannot marshall to DROP statements: %v", err)
+	}
+	expected = []string{
+		"DROP TABLE related_articles;",
+		"DROP TABLE article_tags;",
+		"DROP TABLE node;",
+		"DROP TABLE Article;",
+		"DROP TABLE Tag;",
+		"DROP TABLE orderLine;",
+		"DROP TABLE order;",
+		"DROP TABLE customer;",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected DROP statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+}
+
+func TestSchemaCycle(t *testing.T) {
+	s := NewSchema()
+	for _, in := range []interface{}{customer{}, employee{}, department{}} {
+		if _, err := s.Register(in, ""); err != nil {
+			t.Fatalf("cannot register %T: %v", in, err)
+		}
+	}
+	dr := &ANSISQLDriver{}
+	_, err := s.Create(dr)
+	cycle, ok := err.(*CycleError)
+	if !ok {
+		t.Fatalf("expected a cycle error, got %v", err)
+	}
+	expected := []string{"employee", "department", "employee"}
+	if !reflect.DeepEqual(cycle.Tables, expected) {
+		t.Errorf("unexpected cycle: \nexpected: %q\nobtained: %q", expected, cycle.Tables)
+	}
+	expectedError := "foreign key cycle: employee -> department -> employee"
+	if err.Error() != expectedError {
+		t.Errorf("unexpected error: \nexpected: %q\nobtained: %q", expectedError, err.Error())
+	}
+
+	obtained, err := s.CreateDeferred(dr)
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	expectedSQL := []string{
+		"CREATE TABLE customer (ID SMALLINT, Name VARCHAR, CONSTRAINT pk_customer PRIMARY KEY (ID));",
+		"CREATE TABLE employee (ID SMALLINT, Department_ID_fk SMALLINT, CONSTRAINT pk_employee PRIMARY KEY (ID));",
+		"CREATE TABLE department (ID SMALLINT, Manager_ID_fk SMALLINT, CONSTRAINT pk_department PRIMARY KEY (ID));",
+		"ALTER TABLE employee ADD CONSTRAINT fk_employee_Department_ID_fk FOREIGN KEY (Department_ID_fk) REFERENCES department (ID) ON DELETE CASCADE ON UPDATE CASCADE;",
+		"ALTER TABLE department ADD CONSTRAINT fk_department_Manager_ID_fk FOREIGN KEY (Manager_ID_fk) REFERENCES employee (ID) ON DELETE CASCADE ON UPDATE CASCADE;",
+	}
+	if !reflect.DeepEqual(obtained, expectedSQL) {
+		t.Errorf("unexpected CREATE statements: \nexpected: %q\nobtained: %q", expectedSQL, obtained)
+	}
+
+	obtained, err = s.Drop(dr, DropOptions{})
+	if err != nil {
+		t.Fatalf("cannot marshall to DROP statements: %v", err)
+	}
+	expectedSQL = []string{
+		"ALTER TABLE employee DROP CONSTRAINT fk_employee_Department_ID_fk;",
+		"ALTER TABLE department DROP CONSTRAINT fk_department_Manager_ID_fk;",
+		"DROP TABLE department;",
+		"DROP TABLE employee;",
+		"DROP TABLE customer;",
+	}
+	if !reflect.DeepEqual(obtained, expectedSQL) {
+		t.Errorf("unexpected DROP statements: \nexpected: %q\nobtained: %q", expectedSQL, obtained)
+	}
+
+	obtained, err = s.Truncate(dr, TruncateOptions{})
+	if err != nil {
+		t.Fatalf("cannot marshall to TRUNCATE statements: %v", err)
+	}
+	expectedSQL = []string{
+		"ALTER TABLE employee DROP CONSTRAINT fk_employee_Department_ID_fk;",
+		"ALTER TABLE department DROP CONSTRAINT fk_department_Manager_ID_fk;",
+		"TRUNCATE TABLE department;",
+		"TRUNCATE TABLE employee;",
+		"TRUNCATE TABLE customer;",
+		"ALTER TABLE employee ADD CONSTRAINT fk_employee_Department_ID_fk FOREIGN KEY (Department_ID_fk) REFERENCES department (ID) ON DELETE CASCADE ON UPDATE CASCADE;",
+		"ALTER TABLE department ADD CONSTRAINT fk_department_Manager_ID_fk FOREIGN KEY (Manager_ID_fk) REFERENCES employee (ID) ON DELETE CASCADE ON UPDATE CASCADE;",
+	}
+	if !reflect.DeepEqual(obtained, expectedSQL) {
+		t.Errorf("unexpected TRUNCATE statements: \nexpected: %q\nobtained: %q", expectedSQL, obtained)
+	}
+}
+
+type badColumns struct {
+	ID             int `sql:"primary"`
+	Customer       *customer
+	Customer_ID_fk int
+	Select         string
+	Created        time.Time
+}
+
+type noTimestampDriver struct {
+	ANSISQLDriver
+}
+
+func (d *noTimestampDriver) Define(k ANSISQLFieldKind, name string) (string, bool) {
+	if k == SqlTimestamp {
+		return "", false
+	}
+	return d.ANSISQLDriver.Define(k, name)
+}
+
+func TestValidate(t *testing.T) {
+	s := NewSchema()
+	m, err := s.Register(badColumns{}, "")
+	if err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	if _, err := s.Register(order{}, ""); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	dr := &noTimestampDriver{}
+
+	err = m.Validate(dr)
+	verr, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	expected := []string{
+		`table "badColumns": duplicate column "Customer_ID_fk"`,
+		`table "badColumns": column "Select" is a reserved word`,
+		`table "badColumns": the driver cannot define the type of column "Created"`,
+	}
+	obtained := []string{}
+	for _, p := range verr.Problems {
+		obtained = append(obtained, p.Error())
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected problems: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	err = s.Validate(dr)
+	verr, ok = err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	expected = append(expected,
+		`table "badColumns": foreign key [Customer_ID_fk] references table "customer" which is not in the schema`,
+		`table "order": name is a reserved word`,
+		`table "order": foreign key [Customer_ID_fk] references table "customer" which is not in the schema`,
+	)
+	obtained = []string{}
+	for _, p := range verr.Problems {
+		obtained = append(obtained, p.Error())
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected problems: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	tables := []TableDefinition{
+		{Name: "a", Fields: []FieldDefinition{{Name: "ID", Type: SqlInt}}},
+		{
+			Name:   "b",
+			Fields: []FieldDefinition{{Name: "A_ID_fk", Type: SqlVarchar}, {Name: "A_Name_fk", Type: SqlVarchar}},
+			FKs: []FKDefinition{
+				{Names: []string{"A_ID_fk"}, RemoteNames: []string{"ID"}, RemoteTable: "a"},
+				{Names: []string{"A_Name_fk"}, RemoteNames: []string{"Name"}, RemoteTable: "a"},
+			},
+		},
+	}
+	expected = []string{
+		`table "b": column "A_ID_fk" does not have the type of the column "ID" it references in table "a"`,
+		`table "b": foreign key [A_Name_fk] references column "Name" which is not in table "a"`,
+	}
+	obtained = []string{}
+	for _, p := range validateTables(dr, tables) {
+		obtained = append(obtained, p.Error())
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected problems: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	m, err = NewTypeSQLMarshaller(customer{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	if err := m.Validate(dr); err != nil {
+		t.Errorf("unexpected problems: %v", err)
+	}
+}
+
+func TestDropAndTruncate(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(customer{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	testCases := []struct {
+		name     string
+		driver   SQLDriver
+		drop     DropOptions
+		truncate TruncateOptions
+		expected []string
+	}{
+		{
+			name:     "ansi",
+			driver:   &ANSISQLDriver{},
+			expected: []string{"DROP TABLE customer;", "TRUNCATE TABLE customer;"},
+		},
+		{
+			name:     "postgres with options",
+			driver:   &PostgreSQLDriver{},
+			drop:     DropOptions{IfExists: true, Cascade: true},
+			truncate: TruncateOptions{RestartIdentity: true},
+			expected: []string{"DROP TABLE IF EXISTS customer CASCADE;", "TRUNCATE TABLE customer RESTART IDENTITY;"},
+		},
+		{
+			name:     "oracle",
+			driver:   &OracleSQLDriver{},
+			drop:     DropOptions{Cascade: true},
+			expected: []string{"DROP TABLE customer CASCADE CONSTRAINTS;", "TRUNCATE TABLE customer;"},
+		},
+		{
+			name:     "sqlite",
+			driver:   &SQLiteDriver{},
+			drop:     DropOptions{IfExists: true},
+			expected: []string{"DROP TABLE IF EXISTS customer;", "DELETE FROM customer;"},
+		},
+	}
+	for _, tc := range testCases {
+		drop, err := m.Drop(tc.driver, tc.drop)
+		if err != nil {
+			t.Errorf("%s: cannot marshall to DROP statement: %v", tc.name, err)
+			continue
+		}
+		truncate, err := m.Truncate(tc.driver, tc.truncate)
+		if err != nil {
+			t.Errorf("%s: cannot marshall to TRUNCATE statement: %v", tc.name, err)
+			continue
+		}
+		obtained := []string{drop, truncate}
+		if !reflect.DeepEqual(obtained, tc.expected) {
+			t.Errorf("%s: unexpected statements: \nexpected: %q\nobtained: %q", tc.name, tc.expected, obtained)
+		}
+	}
+
+	if _, err := m.Drop(&SQLiteDriver{}, DropOptions{Cascade: true}); err == nil {
+		t.Errorf("expected an error dropping in cascade in SQLite")
+	}
+	if _, err := m.Truncate(&SQLiteDriver{}, TruncateOptions{RestartIdentity: true}); err == nil {
+		t.Errorf("expected an error restarting identities in SQLite")
+	}
+	if _, err := m.Drop(&OracleSQLDriver{}, DropOptions{IfExists: true}); err == nil {
+		t.Errorf("expected an error dropping if exists in Oracle")
+	}
+}
+
+type commented struct {
+	ID   int    `sql:"primary,comment=the identifier"`
+	Name string `sql:"comment=it's the name"`
+}
+
+func TestCreateOptions(t *testing.T) {
+	m, err := NewTypeSQLMarshaller(commented{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	opts := CreateOptions{
+		IfNotExists: true,
+		Temporary:   true,
+		Schema:      "myschema",
+		Comment:     "a commented table",
+	}
+	c, err := m.CreateWithOptions(&PostgreSQLDriver{}, opts)
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL := `CREATE TEMPORARY TABLE IF NOT EXISTS myschema.commented (ID SMALLINT, Name VARCHAR, CONSTRAINT pk_commented PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+
+	obtained, err := m.Comments(&PostgreSQLDriver{}, opts)
+	if err != nil {
+		t.Fatalf("cannot marshall to COMMENT statements: %v", err)
+	}
+	expected := []string{
+		`COMMENT ON TABLE myschema.commented IS 'a commented table';`,
+		`COMMENT ON COLUMN myschema.commented.ID IS 'the identifier';`,
+		`COMMENT ON COLUMN myschema.commented.Name IS 'it''s the name';`,
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected COMMENT statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	c, err = m.CreateWithOptions(&OracleSQLDriver{}, CreateOptions{Temporary: true})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statement: %v", err)
+	}
+	expectedSQL = `CREATE GLOBAL TEMPORARY TABLE commented (ID SMALLINT, Name VARCHAR, CONSTRAINT pk_commented PRIMARY KEY (ID));`
+	if c != expectedSQL {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expectedSQL, c)
+	}
+	if _, err := m.CreateWithOptions(&OracleSQLDriver{}, CreateOptions{IfNotExists: true}); err == nil {
+		t.Errorf("expected an error creating if not exists in Oracle")
+	}
+	if _, err := m.Comments(&SQLiteDriver{}, CreateOptions{}); !errors.Is(err, ErrNoComments) {
+		t.Errorf("expected an error commenting in SQLite, got %v", err)
+	}
+}
+
+type zooKeeper struct {
+	ID int `sql:"primary"`
+}
+
+type zooAnimal struct {
+	ID     int        `sql:"primary"`
+	Keeper *zooKeeper `sql:"index,comment=who feeds it"`
+}
+
+func TestSchemaCreateOptions(t *testing.T) {
+	s := NewSchema()
+	for _, in := range []interface{}{zooAnimal{}, zooKeeper{}} {
+		if _, err := s.Register(in, ""); err != nil {
+			t.Fatalf("cannot register: %v", err)
+		}
+	}
+	obtained, err := s.CreateWithOptions(&PostgreSQLDriver{}, CreateOptions{IfNotExists: true, Schema: "zoo"})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	expected := []string{
+		"CREATE TABLE IF NOT EXISTS zoo.zooKeeper (ID SMALLINT, CONSTRAINT pk_zooKeeper PRIMARY KEY (ID));",
+		"CREATE TABLE IF NOT EXISTS zoo.zooAnimal (ID SMALLINT, Keeper_ID_fk SMALLINT, CONSTRAINT fk_zooAnimal_Keeper_ID_fk FOREIGN KEY (Keeper_ID_fk) REFERENCES zoo.zooKeeper (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_zooAnimal PRIMARY KEY (ID));",
+		"CREATE INDEX idx_zooAnimal_Keeper ON zoo.zooAnimal (Keeper_ID_fk);",
+		"COMMENT ON COLUMN zoo.zooAnimal.Keeper_ID_fk IS 'who feeds it';",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	obtained, err = s.CreateDeferredWithOptions(&PostgreSQLDriver{}, CreateOptions{Schema: "zoo"})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	expected = []string{
+		"CREATE TABLE zoo.zooAnimal (ID SMALLINT, Keeper_ID_fk SMALLINT, CONSTRAINT pk_zooAnimal PRIMARY KEY (ID));",
+		"CREATE INDEX idx_zooAnimal_Keeper ON zoo.zooAnimal (Keeper_ID_fk);",
+		"COMMENT ON COLUMN zoo.zooAnimal.Keeper_ID_fk IS 'who feeds it';",
+		"CREATE TABLE zoo.zooKeeper (ID SMALLINT, CONSTRAINT pk_zooKeeper PRIMARY KEY (ID));",
+		"ALTER TABLE zoo.zooAnimal ADD CONSTRAINT fk_zooAnimal_Keeper_ID_fk FOREIGN KEY (Keeper_ID_fk) REFERENCES zoo.zooKeeper (ID) ON DELETE CASCADE ON UPDATE CASCADE;",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	obtained, err = s.Drop(&PostgreSQLDriver{}, DropOptions{Schema: "zoo"})
+	if err != nil {
+		t.Fatalf("cannot marshall to DROP statements: %v", err)
+	}
+	expected = []string{
+		"DROP TABLE zoo.zooAnimal;",
+		"DROP TABLE zoo.zooKeeper;",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected DROP statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	obtained, err = s.Truncate(&PostgreSQLDriver{}, TruncateOptions{Schema: "zoo"})
+	if err != nil {
+		t.Fatalf("cannot marshall to TRUNCATE statements: %v", err)
+	}
+	expected = []string{
+		"TRUNCATE TABLE zoo.zooAnimal;",
+		"TRUNCATE TABLE zoo.zooKeeper;",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected TRUNCATE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	// comments are left out for SQLite, as they are from CREATE.
+	obtained, err = s.Create(&SQLiteDriver{})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	expected = []string{
+		"CREATE TABLE zooKeeper (ID SMALLINT, CONSTRAINT pk_zooKeeper PRIMARY KEY (ID));",
+		"CREATE TABLE zooAnimal (ID SMALLINT, Keeper_ID_fk SMALLINT, CONSTRAINT fk_zooAnimal_Keeper_ID_fk FOREIGN KEY (Keeper_ID_fk) REFERENCES zooKeeper (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_zooAnimal PRIMARY KEY (ID));",
+		"CREATE INDEX idx_zooAnimal_Keeper ON zooAnimal (Keeper_ID_fk);",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	if _, err := s.CreateWithOptions(&PostgreSQLDriver{}, CreateOptions{Comment: "a table"}); err == nil {
+		t.Errorf("expected an error setting the same comment to every table")
+	}
+	if _, err := s.CreateWithOptions(&SQLiteDriver{}, CreateOptions{Schema: "zoo"}); err == nil {
+		t.Errorf("expected an error creating tables in a schema in SQLite")
+	}
+	if _, err := s.CreateDeferredWithOptions(&SQLiteDriver{}, CreateOptions{Schema: "zoo"}); err == nil {
+		t.Errorf("expected an error creating tables in a schema in SQLite")
+	}
+	index := IndexDefinition{Name: "idx_zooAnimal_Keeper", Table: "zooAnimal", Columns: []string{"Keeper_ID_fk"}}
+	indexes := CraftIndexes(&SQLiteDriver{}, qualifiedIndexes("zoo", []IndexDefinition{index}))
+	expected = []string{"CREATE INDEX zoo.idx_zooAnimal_Keeper ON zooAnimal (Keeper_ID_fk);"}
+	if !reflect.DeepEqual(indexes, expected) {
+		t.Errorf("unexpected CREATE INDEX statements: \nexpected: %q\nobtained: %q", expected, indexes)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	var old, current *SQLMarshaller
+	var err error
+	{
+		type person struct {
+			ID    int `sql:"primary"`
+			Name  string
+			Age   int
+			Nick  string `sql:"unique"`
+			Email string `sql:"index"`
+		}
+		if old, err = NewTypeSQLMarshaller(person{}, ""); err != nil {
+			t.Fatalf("cannot create marshaler: %v", err)
+		}
+	}
+	{
+		type person struct {
+			ID       int    `sql:"primary"`
+			FullName string `sql:"renamed_from=Name"`
+			Age      int64  `sql:"default=18"`
+			Email    string `sql:"index,comment=contact"`
+			Country  string
+		}
+		if current, err = NewTypeSQLMarshaller(person{}, ""); err != nil {
+			t.Fatalf("cannot create marshaler: %v", err)
+		}
+	}
+	changes, err := current.Diff(&ANSISQLDriver{}, old)
+	if err != nil {
+		t.Fatalf("cannot diff: %v", err)
+	}
+	expected := []Change{
+		{AlterDropConstraint, "person", "ALTER TABLE person DROP CONSTRAINT uq_person_Nick;", false},
+		{AlterRenameColumn, "person", "ALTER TABLE person RENAME COLUMN Name TO FullName;", false},
+		{AlterColumnType, "person", "ALTER TABLE person ALTER COLUMN Age SET DATA TYPE BIGINT;", true},
+		{AlterSetDefault, "person", "ALTER TABLE person ALTER COLUMN Age SET DEFAULT 18;", false},
+		{AlterAddColumn, "person", "ALTER TABLE person ADD COLUMN Country VARCHAR;", false},
+		{AlterDropColumn, "person", "ALTER TABLE person DROP COLUMN Nick;", true},
+		{AlterComment, "person", "COMMENT ON COLUMN person.Email IS 'contact';", false},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: \nexpected: %+v\nobtained: %+v", expected, changes)
+	}
+
+	changes, err = current.Diff(&PostgreSQLDriver{}, old)
+	if err != nil {
+		t.Fatalf("cannot diff: %v", err)
+	}
+	expectedSQL := "ALTER TABLE person ALTER COLUMN Age TYPE BIGINT;"
+	if changes[2].Statement != expectedSQL {
+		t.Errorf("unexpected ALTER statement: \nexpected: %q\nobtained: %q", expectedSQL, changes[2].Statement)
+	}
+	if _, err := current.Diff(&SQLiteDriver{}, old); err == nil {
+		t.Errorf("expected an error changing the type of a column in SQLite")
+	}
+
+	changes, err = old.Diff(&ANSISQLDriver{}, old)
+	if err != nil {
+		t.Fatalf("cannot diff: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("unexpected changes for the same table: %+v", changes)
+	}
+}
+
+func TestDiffSchemas(t *testing.T) {
+	old, current := NewSchema(), NewSchema()
+	for _, in := range []interface{}{customer{}, node{}} {
+		if _, err := old.Register(in, ""); err != nil {
+			t.Fatalf("cannot register %T: %v", in, err)
+		}
+	}
+	for _, in := range []interface{}{customer{}, order{}} {
+		if _, err := current.Register(in, ""); err != nil {
+			t.Fatalf("cannot register %T: %v", in, err)
+		}
+	}
+	changes, err := current.Diff(&ANSISQLDriver{}, old)
+	if err != nil {
+		t.Fatalf("cannot diff: %v", err)
+	}
+	expected := []Change{
+		{AlterCreateTable, "order", "CREATE TABLE order (Number SMALLINT, Customer_ID_fk SMALLINT, CONSTRAINT fk_order_Customer_ID_fk FOREIGN KEY (Customer_ID_fk) REFERENCES customer (ID) ON DELETE CASCADE ON UPDATE CASCADE, CONSTRAINT pk_order PRIMARY KEY (Number ,Customer_ID_fk));", false},
+		{AlterDropTable, "node", "DROP TABLE node;", true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: \nexpected: %+v\nobtained: %+v", expected, changes)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatalf("cannot create a directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	migrations := NewMigrations(dir, &ANSISQLDriver{})
+
+	first, second := NewSchema(), NewSchema()
+	{
+		type account struct {
+			ID   int `sql:"primary"`
+			Name string
+		}
+		if _, err := first.Register(account{}, ""); err != nil {
+			t.Fatalf("cannot register: %v", err)
+		}
+	}
+	{
+		type account struct {
+			ID       int    `sql:"primary"`
+			FullName string `sql:"renamed_from=Name"`
+		}
+		if _, err := second.Register(account{}, ""); err != nil {
+			t.Fatalf("cannot register: %v", err)
+		}
+		if _, err := second.Register(customer{}, ""); err != nil {
+			t.Fatalf("cannot register: %v", err)
+		}
+	}
+
+	if _, err := migrations.Generate(first, "init"); err != nil {
+		t.Fatalf("cannot generate the migration: %v", err)
+	}
+	migration, err := migrations.Generate(first, "nothing")
+	if err != nil {
+		t.Fatalf("cannot generate the migration: %v", err)
+	}
+	if migration != nil {
+		t.Errorf("unexpected migration without changes: %+v", migration)
+	}
+	if err := migrations.Verify(first); err != nil {
+		t.Errorf("unexpected error verifying the migrations: %v", err)
+	}
+	if err := migrations.Verify(second); err == nil {
+		t.Errorf("expected an error verifying outdated migrations")
+	}
+	if _, err := migrations.Generate(second, "rename"); err != nil {
+		t.Fatalf("cannot generate the migration: %v", err)
+	}
+	if err := migrations.Verify(second); err != nil {
+		t.Errorf("unexpected error verifying the migrations: %v", err)
+	}
+
+	expected := map[string]string{
+		"0001_init.up.sql":     "CREATE TABLE account (ID SMALLINT, Name VARCHAR, CONSTRAINT pk_account PRIMARY KEY (ID));\n",
+		"0001_init.down.sql":   "-- destructive\nDROP TABLE account;\n",
+		"0002_rename.up.sql":   "CREATE TABLE customer (ID SMALLINT, Name VARCHAR, CONSTRAINT pk_customer PRIMARY KEY (ID));\nALTER TABLE account RENAME COLUMN Name TO FullName;\n",
+		"0002_rename.down.sql": "ALTER TABLE account RENAME COLUMN FullName TO Name;\n-- destructive\nDROP TABLE customer;\n",
+	}
+	for name, content := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("cannot read %q: %v", name, err)
+			continue
+		}
+		if string(data) != content {
+			t.Errorf("unexpected %q: \nexpected: %q\nobtained: %q", name, content, string(data))
+		}
+	}
+
+	third := NewSchema()
+	{
+		type account struct {
+			ID       int    `sql:"primary"`
+			FullName string `sql:"comment=the name"`
+			Email    string `sql:"index,check=Email <> ''"`
+			Age      int64  `sql:"default=18"`
+			Motto    string `sql:"default=carpe; diem"`
+		}
+		if _, err := third.Register(account{}, ""); err != nil {
+			t.Fatalf("cannot register: %v", err)
+		}
+	}
+	if _, err := migrations.Generate(third, "details"); err != nil {
+		t.Fatalf("cannot generate the migration: %v", err)
+	}
+	if err := migrations.Verify(third); err != nil {
+		t.Errorf("unexpected error verifying the migrations: %v", err)
+	}
+
+	down := filepath.Join(dir, "0002_rename.down.sql")
+	if err := ioutil.WriteFile(down, []byte("-- destructive\nDROP TABLE customer;\n"), 0644); err != nil {
+		t.Fatalf("cannot write %q: %v", down, err)
+	}
+	_, err = migrations.Replay()
+	expectedErr := "reverting migration 2: the statements are not the ones between the snapshots"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("unexpected error replaying a modified migration: \nexpected: %q\nobtained: %v", expectedErr, err)
+	}
+
+	up := filepath.Join(dir, "0002_rename.up.sql")
+	if err := ioutil.WriteFile(up, []byte("DROP TABLE account;\n"), 0644); err != nil {
+		t.Fatalf("cannot write %q: %v", up, err)
+	}
+	if _, err := migrations.Replay(); err == nil {
+		t.Errorf("expected an error replaying a modified migration")
+	}
+}
+
+func TestSplitChanges(t *testing.T) {
+	script := "-- a comment\nCOMMENT ON TABLE a IS 'x;\n-- y';\n-- destructive\nDROP\n  TABLE a; -- gone\n"
+	changes, err := splitChanges(script)
+	if err != nil {
+		t.Fatalf("cannot split the statements: %v", err)
+	}
+	expected := []Change{
+		{Statement: "COMMENT ON TABLE a IS 'x;\n-- y';"},
+		{Statement: "DROP\n  TABLE a;", Destructive: true},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: \nexpected: %+v\nobtained: %+v", expected, changes)
+	}
+	if _, err := splitChanges("DROP TABLE a"); err == nil {
+		t.Errorf("expected an error for a statement without semicolon")
+	}
+
+	script = "ALTER TABLE a ADD COLUMN b VARCHAR DEFAULT \"x;\\\"y'\";\nDROP TABLE c;\n"
+	changes, err = splitChanges(script)
+	if err != nil {
+		t.Fatalf("cannot split the statements: %v", err)
+	}
+	expected = []Change{
+		{Statement: "ALTER TABLE a ADD COLUMN b VARCHAR DEFAULT \"x;\\\"y'\";"},
+		{Statement: "DROP TABLE c;"},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("unexpected changes: \nexpected: %+v\nobtained: %+v", expected, changes)
+	}
+}
+
+type toggle struct {
+	ID      int `sql:"primary"`
+	Enabled bool
+}
+
+func TestIntrospectSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("cannot open the database: %v", err)
+	}
+	defer db.Close()
+	// every connection has its own in memory database.
+	db.SetMaxOpenConns(1)
+
+	s := NewSchema()
+	for _, in := range []interface{}{customer{}, Tag{}, Article{}, node{}, dumbFK{}, indexed{}, toggle{}} {
+		if _, err := s.Register(in, ""); err != nil {
+			t.Fatalf("cannot register %T: %v", in, err)
+		}
+	}
+	dr := &SQLiteDriver{}
+	creates, err := s.Create(dr)
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	for _, c := range creates {
+		if _, err := db.Exec(c); err != nil {
+			t.Fatalf("cannot run %q: %v", c, err)
+		}
+	}
+
+	tables, err := Introspect(dr, db)
+	if err != nil {
+		t.Fatalf("cannot read the schema: %v", err)
+	}
+	for _, unsupported := range []SQLDriver{&ANSISQLDriver{}, &OracleSQLDriver{}} {
+		if _, err := Introspect(unsupported, db); err == nil {
+			t.Errorf("expected an error reading the schema with %T", unsupported)
+		}
+	}
+	names := []string{}
+	for _, table := range tables {
+		names = append(names, table.Name)
+	}
+	expectedNames := []string{"customer", "Tag", "Article", "node", "dumbFK", "indexed", "toggle", "article_tags", "related_articles"}
+	if !reflect.DeepEqual(names, expectedNames) {
+		t.Errorf("unexpected tables: \nexpected: %q\nobtained: %q", expectedNames, names)
+	}
+	expected := TableDefinition{
+		Name: "indexed",
+		Fields: []FieldDefinition{
+			{Name: "ID", Type: SqlSmallInt},
+			{Name: "Email", Type: SqlVarchar, Nullable: true},
+			{Name: "FirstName", Type: SqlVarchar, Nullable: true},
+			{Name: "LastName", Type: SqlVarchar, Nullable: true},
+			{Name: "Age", Type: SqlSmallInt, Nullable: true},
+			{Name: "Ref_aField_fk", Type: SqlSmallInt, Nullable: true},
+		},
+		FKs: []FKDefinition{{
+			Names:       []string{"Ref_aField_fk"},
+			RemoteNames: []string{"aField"},
+			RemoteTable: "dumbFK",
+			OnDelete:    FKCascade,
+			OnUpdate:    FKCascade,
+		}},
+		PKs: []string{"ID"},
+		Indexes: []IndexDefinition{
+			{Name: "email_unique", Table: "indexed", Columns: []string{"Email"}, Unique: true},
+			{Name: "full_name", Table: "indexed", Columns: []string{"FirstName", "LastName"}},
+			{Name: "idx_indexed_Age", Table: "indexed", Columns: []string{"Age"}},
+		},
+	}
+	if len(tables) == len(expectedNames) && !reflect.DeepEqual(tables[5], expected) {
+		t.Errorf("unexpected table: \nexpected: %+v\nobtained: %+v", expected, tables[5])
+	}
+
+	// the structs generated from the database are the ones generated from
+	// the schema, where only primary keys are created NOT NULL.
+	definitions, err := s.Definitions()
+	if err != nil {
+		t.Fatalf("cannot define the tables: %v", err)
+	}
+	for _, table := range definitions {
+		for i, f := range table.Fields {
+			table.Fields[i].Nullable = !containsAll(table.PKs, []string{f.Name})
+		}
+	}
+	expectedSource, err := GenerateStructs("models", sortTables(definitions))
+	if err != nil {
+		t.Fatalf("cannot generate the structs: %v", err)
+	}
+	obtainedSource, err := GenerateStructs("models", tables)
+	if err != nil {
+		t.Fatalf("cannot generate the structs: %v", err)
+	}
+	if string(obtainedSource) != string(expectedSource) {
+		t.Errorf("unexpected generated source: \nexpected: %s\nobtained: %s", expectedSource, obtainedSource)
+	}
+	goKinds := map[string]reflect.Kind{
+		"int":     reflect.Int,
+		"int32":   reflect.Int32,
+		"int64":   reflect.Int64,
+		"float32": reflect.Float32,
+		"float64": reflect.Float64,
+		"string":  reflect.String,
+	}
+	for _, table := range tables {
+		for _, f := range table.Fields {
+			goType := goTypes[f.Type]
+			kind, err := resolveType(goKinds[goType])
+			if err != nil || kind != f.Type {
+				t.Errorf("column %s.%s of type %v is generated as %s, tokenized as %v", table.Name, f.Name, f.Type, goType, kind)
+			}
+		}
+	}
+
+	changes, err := s.Drift(dr, db)
+	if err != nil {
+		t.Fatalf("cannot diff the schema: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("unexpected drift: %+v", changes)
+	}
+
+	if _, err := db.Exec("ALTER TABLE customer ADD COLUMN Extra INT;"); err != nil {
+		t.Fatalf("cannot alter the table: %v", err)
+	}
+	changes, err = s.Drift(dr, db)
+	if err != nil {
+		t.Fatalf("cannot diff the schema: %v", err)
+	}
+	expectedChanges := []Change{
+		{AlterDropColumn, "customer", "ALTER TABLE customer DROP COLUMN Extra;", true},
+	}
+	if !reflect.DeepEqual(changes, expectedChanges) {
+		t.Errorf("unexpected drift: \nexpected: %+v\nobtained: %+v", expectedChanges, changes)
+	}
+}
+
+// users is the struct generated from the users table of TestGenerateFromSQLite.
+type users struct {
+	ID        int32      `sql:"primary,column=id"`
+	Name      string     `sql:"column=name"`
+	Age       *int32     `sql:"column=age"`
+	Nick      *string    `sql:"column=nick,size=20"`
+	CreatedAt *time.Time `sql:"column=created_at"`
+}
+
+func TestGenerateFromSQLite(t *testing.T) {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatalf("cannot open the database: %v", err)
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+	create := "CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT NOT NULL, age INTEGER, nick VARCHAR(20), created_at TIMESTAMP);"
+	if _, err := db.Exec(create); err != nil {
+		t.Fatalf("cannot run %q: %v", create, err)
+	}
+	tables, err := Introspect(&SQLiteDriver{}, db)
+	if err != nil {
+		t.Fatalf("cannot read the schema: %v", err)
+	}
+	obtained, err := GenerateStructs("models", tables)
+	if err != nil {
+		t.Fatalf("cannot generate the structs: %v", err)
+	}
+	expected := "package models\n\n" +
+		"import \"time\"\n\n" +
+		"// users holds the rows of the table users.\n" +
+		"type users struct {\n" +
+		"\tID        int32      `sql:\"primary,column=id\"`\n" +
+		"\tName      string     `sql:\"column=name\"`\n" +
+		"\tAge       *int32     `sql:\"column=age\"`\n" +
+		"\tNick      *string    `sql:\"column=nick,size=20\"`\n" +
+		"\tCreatedAt *time.Time `sql:\"column=created_at\"`\n" +
+		"}\n"
+	if string(obtained) != expected {
+		t.Errorf("unexpected generated source: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	// the generated struct marshals into the columns of the table.
+	m, err := NewTypeSQLMarshaller(users{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaler: %v", err)
+	}
+	created := time.Date(2016, 5, 4, 3, 2, 1, 0, time.UTC)
+	insert, err := m.Insert(users{ID: 1, Name: "a name", CreatedAt: &created})
+	if err != nil {
+		t.Fatalf("cannot marshall to INSERT statement: %v", err)
+	}
+	expectedSQL := `INSERT INTO users (id, name, age, nick, created_at) VALUES (1, "a name", NULL, NULL, "2016-05-04 03:02:01");`
+	if insert != expectedSQL {
+		t.Errorf("unexpected INSERT statement: \nexpected: %q\nobtained: %q", expectedSQL, insert)
+	}
+	if _, err := db.Exec(insert); err != nil {
+		t.Fatalf("cannot run %q: %v", insert, err)
+	}
+	var u users
+	if err := m.Scan(db.QueryRow("SELECT id, name, age, nick, created_at FROM users;"), &u); err != nil {
+		t.Fatalf("cannot scan the row: %v", err)
+	}
+	if u.ID != 1 || u.Name != "a name" || u.Age != nil || u.CreatedAt == nil || !u.CreatedAt.Equal(created) {
+		t.Errorf("unexpected row: %+v", u)
+	}
+}
+
+func TestInformationSchemaDefaults(t *testing.T) {
+	type reported struct {
+		def  string
+		kind ANSISQLFieldKind
+	}
+	pg := map[reported]string{
+		{"'active'::character varying", SqlVarchar}:     `"active"`,
+		{"'it''s'::text", SqlVarchar}:                   `"it's"`,
+		{"nextval('account_id_seq'::regclass)", SqlInt}: "",
+		{"18", SqlInt}:            "18",
+		{"'-1'::integer", SqlInt}: "-1",
+		{"1.5", SqlDouble}:        "1.500000",
+		{"'2016-05-04 03:02:01'::timestamp without time zone", SqlTimestamp}: `"2016-05-04 03:02:01"`,
+		{"CURRENT_TIMESTAMP", SqlTimestamp}:                                  "CURRENT_TIMESTAMP",
+	}
+	for in, expected := range pg {
+		if obtained := pgDefault(in.def, in.kind); obtained != expected {
+			t.Errorf("unexpected PostgreSQL default: \nexpected: %q\nobtained: %q", expected, obtained)
+		}
+	}
+	mysql := map[reported]string{
+		{"active", SqlVarchar}:                `"active"`,
+		{"18", SqlInt}:                        "18",
+		{"1.5", SqlDouble}:                    "1.500000",
+		{"2016-05-04 03:02:01", SqlTimestamp}: `"2016-05-04 03:02:01"`,
+		{"CURRENT_TIMESTAMP", SqlTimestamp}:   "CURRENT_TIMESTAMP",
+	}
+	for in, expected := range mysql {
+		if obtained := mysqlDefault(in.def, in.kind); obtained != expected {
+			t.Errorf("unexpected MySQL default: \nexpected: %q\nobtained: %q", expected, obtained)
+		}
+	}
+
+	// defaults read from an unchanged table do not drift.
+	schema := NewSchema()
+	if _, err := schema.Register(withDefaults{}, ""); err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	definitions, err := schema.Definitions()
+	if err != nil {
+		t.Fatalf("cannot define the tables: %v", err)
+	}
+	current := definitions[0]
+	live := current
+	live.Fields = append([]FieldDefinition{}, current.Fields...)
+	reports := map[string]string{"Name": "'unnamed'::character varying", "Age": "18", "Score": "1.5", "Comment": "NULL::character varying"}
+	for i, f := range live.Fields {
+		live.Fields[i].Default = pgDefault(reports[f.Name], f.Type)
+	}
+	changes, err := DiffTables(&PostgreSQLDriver{}, live, current)
+	if err != nil {
+		t.Fatalf("cannot diff the tables: %v", err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("unexpected drift: %+v", changes)
+	}
+
+	if _, ok := SQLDriver(&MySQLDriver{}).(Introspector); !ok {
+		t.Errorf("MySQLDriver cannot read the schema of a database")
+	}
+	for name, expected := range map[string]ANSISQLFieldKind{"tinyint": SqlSmallInt, "datetime": SqlTimestamp, "longtext": SqlVarchar} {
+		if kind, _, err := introspectedType("column", name); err != nil || kind != expected {
+			t.Errorf("unexpected type of %q: \nexpected: %v\nobtained: %v (%v)", name, expected, kind, err)
+		}
+	}
+}
+
+func TestGenerateStructs(t *testing.T) {
+	s := NewSchema()
+	for _, in := range []interface{}{dumbFK{}, indexed{}, customer{}, order{}} {
+		if _, err := s.Register(in, ""); err != nil {
+			t.Fatalf("cannot register %T: %v", in, err)
+		}
+	}
+	tables, err := s.Definitions()
+	if err != nil {
+		t.Fatalf("cannot define the tables: %v", err)
+	}
+	tables[0].Fields[1].Nullable = true
+	tables[2].Uniques = []UniqueDefinition{{Columns: []string{"ID", "Name"}}}
+	obtained, err := GenerateStructs("models", tables)
+	if err != nil {
+		t.Fatalf("cannot generate the structs: %v", err)
+	}
+	expected := "package models\n\n" +
+		"// dumbFK holds the rows of the table dumbFK.\n" +
+		"type dumbFK struct {\n" +
+		"\tAField       int     `sql:\"primary,column=aField\"`\n" +
+		"\tAnotherField *string `sql:\"column=anotherField\"`\n" +
+		"}\n\n" +
+		"// indexed holds the rows of the table indexed.\n" +
+		"type indexed struct {\n" +
+		"\tID        int    `sql:\"primary\"`\n" +
+		"\tEmail     string `sql:\"uniqueindex=email_unique\"`\n" +
+		"\tFirstName string `sql:\"index=full_name\"`\n" +
+		"\tLastName  string `sql:\"index=full_name\"`\n" +
+		"\tAge       int    `sql:\"index\"`\n" +
+		"\tRef       *dumbFK\n" +
+		"}\n\n" +
+		"// customer holds the rows of the table customer.\n" +
+		"// UNIQUE (ID, Name) cannot be expressed with tags.\n" +
+		"type customer struct {\n" +
+		"\tID   int `sql:\"primary\"`\n" +
+		"\tName string\n" +
+		"}\n\n" +
+		"// order holds the rows of the table order.\n" +
+		"type order struct {\n" +
+		"\tNumber   int       `sql:\"primary\"`\n" +
+		"\tCustomer *customer `sql:\"primary\"`\n" +
+		"}\n"
+	if string(obtained) != expected {
+		t.Errorf("unexpected generated source: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+	if _, err := GenerateStructs("models", tables[1:2]); err == nil {
+		t.Errorf("expected an error generating a Foreign Key to a table that is not generated")
+	}
+}
+
+func TestLoadSchema(t *testing.T) {
+	s, err := LoadSchema(strings.NewReader(`
+tables:
+  owners:
+    fields:
+      id:
+        type: int
+        primary: true
+  pets:
+    fields:
+      name:
+        type: string
+        size: 50
+        primary: true
+      nickname:
+        type: string
+        nullable: true
+        default: Rex
+        uniqueindex: true
+      owner:
+        references: owners.id
+        nullable: true
+        ondelete: setnull
+        index: pets_owner`))
+	if err != nil {
+		t.Fatalf("cannot load the schema: %v", err)
+	}
+	obtained, err := s.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	expected := []string{
+		"CREATE TABLE owners (id SMALLINT, CONSTRAINT pk_owners PRIMARY KEY (id));",
+		"CREATE TABLE pets (name VARCHAR(50), nickname VARCHAR DEFAULT \"Rex\", owner_id_fk SMALLINT, CONSTRAINT fk_pets_owner_id_fk FOREIGN KEY (owner_id_fk) REFERENCES owners (id) ON DELETE SET NULL ON UPDATE CASCADE, CONSTRAINT pk_pets PRIMARY KEY (name));",
+		"CREATE INDEX pets_owner ON pets (owner_id_fk);",
+		"CREATE UNIQUE INDEX uidx_pets_nickname ON pets (nickname);",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	invalid := map[string]string{
+		`{"tables": {"pets": {"fields": {"owner": {"references": "owners.id"}}}}}`:                                                                                     `pets.owner.references: table "owners" is not registered`,
+		`{"tables": {"owners": {"fields": {"id": {"type": "int"}}}, "pets": {"fields": {"owner": {"references": "owners.id"}}}}}`:                                      `pets.owner.references: "id" is not the primary key of "owners"`,
+		`{"tables": {"owners": {"fields": {"id": {"type": "int", "primary": true}}}, "pets": {"fields": {"owner": {"references": "owners", "ondelete": "setnull"}}}}}`: `foreign key field "owner" must be nullable to be set to NULL`,
+	}
+	for document, expectedErr := range invalid {
+		_, err := LoadSchema(strings.NewReader(document))
+		if err == nil || !strings.Contains(err.Error(), expectedErr) {
+			t.Errorf("unexpected error: \nexpected: %q\nobtained: %v", expectedErr, err)
+		}
+	}
+}
+
+func TestLoadJSONSchema(t *testing.T) {
+	s, err := LoadJSONSchema(strings.NewReader(`
+openapi: 3.0.0
+components:
+  schemas:
+    Status:
+      type: string
+      maxLength: 10
+    Owner:
+      type: object
+      required: [id, name]
+      properties:
+        id:
+          type: integer
+          format: int64
+          x-sql: primary
+        name:
+          type: string
+          maxLength: 100
+          description: full name
+        joined:
+          type: string
+          format: date-time
+          default: 2024-01-02T03:04:05Z
+        born:
+          type: string
+          format: date
+          default: 1990-05-06
+        status:
+          $ref: '#/components/schemas/Status'
+          default: active
+    Pet:
+      type: object
+      required: [id]
+      properties:
+        id:
+          type: string
+          format: uuid
+          x-sql: primary
+        owner:
+          allOf:
+          - $ref: '#/components/schemas/Owner'
+          x-sql: ondelete=setnull,index
+        weight:
+          type: number
+          format: float
+        vaccinated:
+          type: boolean
+        tags:
+          type: array
+          items:
+            type: string`))
+	if err != nil {
+		t.Fatalf("cannot load the schema: %v", err)
+	}
+	obtained, err := s.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statements: %v", err)
+	}
+	expected := []string{
+		"CREATE TABLE Owner (id BIGINT, name VARCHAR(100), joined TIMESTAMP DEFAULT \"2024-01-02 03:04:05\", born TIMESTAMP DEFAULT \"1990-05-06 00:00:00\", status VARCHAR(10) DEFAULT \"active\", CONSTRAINT pk_Owner PRIMARY KEY (id));",
+		"COMMENT ON COLUMN Owner.name IS 'full name';",
+		"CREATE TABLE Pet (id CHAR(36), owner_id_fk BIGINT, weight FLOAT, vaccinated INT, CONSTRAINT fk_Pet_owner_id_fk FOREIGN KEY (owner_id_fk) REFERENCES Owner (id) ON DELETE SET NULL ON UPDATE CASCADE, CONSTRAINT pk_Pet PRIMARY KEY (id));",
+		"CREATE INDEX idx_Pet_owner ON Pet (owner_id_fk);",
+	}
+	if !reflect.DeepEqual(obtained, expected) {
+		t.Errorf("unexpected CREATE statements: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	invalid := map[string]string{
+		`{"definitions": {"Pet": {"properties": {"owner": {"$ref": "#/definitions/Owner"}}}}}`:                                       `Pet.owner.references: table "Owner" is not registered`,
+		`{"definitions": {"Pet": {"properties": {"name": {"type": "text"}}}}}`:                                                       `Pet.name.type: unknown type text`,
+		`{"definitions": {"Pet": {"properties": {"name": {"type": "string", "maxLength": -1}}}}}`:                                    `Pet.name.maxLength: must be a positive integer, got -1`,
+		`{"definitions": {"Pet": {"properties": {"born": {"type": "string", "format": "date", "default": "1990-05-06 00:00:00"}}}}}`: `Pet.born.default: parsing time "1990-05-06 00:00:00": extra text: " 00:00:00"`,
+	}
+	for document, expectedErr := range invalid {
+		_, err := LoadJSONSchema(strings.NewReader(document))
+		if err == nil || err.Error() != expectedErr {
+			t.Errorf("unexpected error: \nexpected: %q\nobtained: %v", expectedErr, err)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	type unsupported struct {
+		ID int `sql:"primary"`
+		C  chan int
+	}
+	_, err := NewTypeSQLMarshaller(unsupported{}, "")
+	var typeErr *ErrUnsupportedType
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected an unsupported type error, got %v", err)
+	}
+	expectedErr := ErrUnsupportedType{Field: "C", Kind: reflect.Chan}
+	if *typeErr != expectedErr {
+		t.Errorf("unexpected error: \nexpected: %+v\nobtained: %+v", expectedErr, *typeErr)
+	}
+
+	type noPK struct {
+		Name string
+	}
+	m, err := NewTypeSQLMarshaller(noPK{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaller: %v", err)
+	}
+	if _, err := m.DeletePK(noPK{Name: "a"}); !errors.Is(err, ErrNoPrimaryKey) {
+		t.Errorf("expected %v, got %v", ErrNoPrimaryKey, err)
+	}
+
+	s := NewSchema()
+	m, err = s.Register(badColumns{}, "")
+	if err != nil {
+		t.Fatalf("cannot register: %v", err)
+	}
+	if err := m.Validate(&ANSISQLDriver{}); !errors.Is(err, ErrDuplicateField) {
+		t.Errorf("expected %v, got %v", ErrDuplicateField, err)
+	}
+	if _, err := s.Register(badColumns{}, ""); !errors.Is(err, ErrDuplicateTable) {
+		t.Errorf("expected %v, got %v", ErrDuplicateTable, err)
+	}
+
+	type stamped struct {
+		ID      int `sql:"primary"`
+		Created time.Time
+	}
+	m, err = NewTypeSQLMarshaller(stamped{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaller: %v", err)
+	}
+	_, err = m.Create(&noTimestampDriver{})
+	if !errors.As(err, &typeErr) {
+		t.Fatalf("expected an unsupported type error, got %v", err)
+	}
+	expectedErr = ErrUnsupportedType{Field: "Created", Type: SqlTimestamp}
+	if *typeErr != expectedErr {
+		t.Errorf("unexpected error: \nexpected: %+v\nobtained: %+v", expectedErr, *typeErr)
+	}
+}
+
+func TestFor(t *testing.T) {
+	var wg sync.WaitGroup
+	marshallers := make([]*SQLMarshaller, 8)
+	for i := range marshallers {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m, err := For[orderLine]()
+			if err != nil {
+				t.Errorf("cannot create marshaller: %v", err)
+				return
+			}
+			marshallers[i] = m
+		}(i)
+	}
+	wg.Wait()
+	for _, m := range marshallers {
+		if m == nil || m.tokenized != marshallers[0].tokenized {
+			t.Fatalf("the marshallers do not share the tokenized type")
+		}
+	}
+
+	m, err := NewTypeSQLMarshaller(orderLine{}, "")
+	if err != nil {
+		t.Fatalf("cannot create marshaller: %v", err)
+	}
+	if m.tokenized != marshallers[0].tokenized {
+		t.Errorf("NewTypeSQLMarshaller does not share the tokenized type")
+	}
+	expected, err := m.Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statement: %v", err)
+	}
+	obtained, err := marshallers[0].Create(&ANSISQLDriver{})
+	if err != nil {
+		t.Fatalf("cannot marshall to CREATE statement: %v", err)
+	}
+	if obtained != expected {
+		t.Errorf("unexpected CREATE statement: \nexpected: %q\nobtained: %q", expected, obtained)
+	}
+
+	named, err := NewTypeSQLMarshaller(orderLine{}, "lines")
+	if err != nil {
+		t.Fatalf("cannot create marshaller: %v", err)
+	}
+	if named.tokenized == m.tokenized {
+		t.Errorf("a type with another name shares the tokenized type")
+	}
+}
+
+func BenchmarkTokenizeType(b *testing.B) {
+	b.ReportAllocs()
+	t := reflect.TypeOf(orderLine{})
+	for i := 0; i < b.N; i++ {
+		if _, err := TokenizeType(t, t.Name()); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFor(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := For[orderLine](); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInsert(b *testing.B) {
+	b.ReportAllocs()
+	line := orderLine{Line: 1, Order: &order{Number: 2, Customer: &customer{ID: 3}}}
+	for i := 0; i < b.N; i++ {
+		m, err := For[orderLine]()
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := m.Insert(line); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,553 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	migrationUp       = ".up.sql"
+	migrationDown     = ".down.sql"
+	migrationSnapshot = ".json"
+
+	// destructiveMark precedes destructive statements in the files.
+	destructiveMark = "-- destructive"
+)
+
+// Migration is a numbered step between two versions of a schema, Schema
+// is the snapshot of the tables after Up runs, before Down runs.
+type Migration struct {
+	Version int
+	Name    string
+	Up      []Change
+	Down    []Change
+	Schema  []TableDefinition
+}
+
+// Migrations manages the migration files of a directory, for each
+// version there is a <version>_<name>.up.sql and .down.sql files with
+// the statements and a .json file with the snapshot of the schema.
+type Migrations struct {
+	dir    string
+	driver SQLDriver
+}
+
+// NewMigrations returns a Migrations for the files in dir with their
+// statements rendered by driver.
+func NewMigrations(dir string, driver SQLDriver) *Migrations {
+	return &Migrations{dir: dir, driver: driver}
+}
+
+// base returns the path to the files of the passed migration without
+// their extension.
+func (m *Migrations) base(version int, name string) string {
+	return filepath.Join(m.dir, fmt.Sprintf("%04d_%s", version, name))
+}
+
+// Load returns the migrations in the directory sorted by version.
+func (m *Migrations) Load() ([]Migration, error) {
+	snapshots, err := filepath.Glob(filepath.Join(m.dir, "*"+migrationSnapshot))
+	if err != nil {
+		return nil, err
+	}
+	migrations := []Migration{}
+	for _, snapshot := range snapshots {
+		base := strings.TrimSuffix(filepath.Base(snapshot), migrationSnapshot)
+		parts := strings.SplitN(base, "_", 2)
+		version, err := strconv.Atoi(parts[0])
+		if err != nil || len(parts) != 2 {
+			return nil, fmt.Errorf("%q is not named <version>_<name>%s", snapshot, migrationSnapshot)
+		}
+		migration := Migration{Version: version, Name: parts[1]}
+		data, err := ioutil.ReadFile(snapshot)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, &migration.Schema); err != nil {
+			return nil, fmt.Errorf("reading the snapshot %q: %w", snapshot, err)
+		}
+		if migration.Up, err = readChanges(m.base(version, parts[1]) + migrationUp); err != nil {
+			return nil, err
+		}
+		if migration.Down, err = readChanges(m.base(version, parts[1]) + migrationDown); err != nil {
+			return nil, err
+		}
+		migrations = append(migrations, migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i := range migrations {
+		if migrations[i].Version != i+1 {
+			return nil, fmt.Errorf("expected migration %d, found %d", i+1, migrations[i].Version)
+		}
+	}
+	return migrations, nil
+}
+
+// readChanges reads the statements of a migration file, only the
+// statements and whether they are destructive are known.
+func readChanges(path string) ([]Change, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return splitChanges(string(data))
+}
+
+// splitChanges splits the passed script into its statements, which end
+// with a semicolon outside of string literals and might span several
+// lines. Literals are quoted with single quotes, or double quotes with
+// backslash escapes as defaults are rendered. Comments are skipped, the
+// destructive mark applies to the statement that follows it.
+func splitChanges(script string) ([]Change, error) {
+	changes := []Change{}
+	destructive := false
+	statement := strings.Builder{}
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote == '"' && c == '\\' && i+1 < len(script):
+			statement.WriteByte(c)
+			i++
+			c = script[i]
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end == -1 {
+				end = len(script) - i
+			}
+			if strings.TrimSpace(script[i:i+end]) == destructiveMark {
+				destructive = true
+			}
+			i += end - 1
+			continue
+		case c == ';':
+			statement.WriteByte(c)
+			changes = append(changes, Change{Statement: strings.TrimSpace(statement.String()), Destructive: destructive})
+			statement.Reset()
+			destructive = false
+			continue
+		}
+		statement.WriteByte(c)
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated string literal")
+	}
+	if rest := strings.TrimSpace(statement.String()); rest != "" {
+		return nil, fmt.Errorf("statement %q does not end with a semicolon", rest)
+	}
+	return changes, nil
+}
+
+// writeChanges writes the statements of a migration file, one per line
+// with the destructive ones preceded by a mark, see splitChanges.
+func writeChanges(path string, changes []Change) error {
+	lines := []string{}
+	for _, c := range changes {
+		if c.Destructive {
+			lines = append(lines, destructiveMark)
+		}
+		lines = append(lines, c.Statement)
+	}
+	return ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+}
+
+// reverseRenames returns a copy of the previous tables where the columns
+// renamed in current have RenamedFrom set to their new name, so diffing
+// current into previous renames them back.
+func reverseRenames(previous, current []TableDefinition) []TableDefinition {
+	renamed := map[string]map[string]string{}
+	for _, t := range current {
+		for _, f := range t.Fields {
+			if f.RenamedFrom != "" {
+				if renamed[t.Name] == nil {
+					renamed[t.Name] = map[string]string{}
+				}
+				renamed[t.Name][f.RenamedFrom] = f.Name
+			}
+		}
+	}
+	reversed := make([]TableDefinition, len(previous))
+	for i, t := range previous {
+		t.Fields = append([]FieldDefinition{}, t.Fields...)
+		for j := range t.Fields {
+			t.Fields[j].RenamedFrom = renamed[t.Name][t.Fields[j].Name]
+		}
+		reversed[i] = t
+	}
+	return reversed
+}
+
+// Generate writes the files of a new migration with the passed name from
+// the schema of the last one to the passed schema, it returns nil if
+// nothing changed.
+func (m *Migrations) Generate(s *Schema, name string) (*Migration, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, fmt.Errorf("invalid migration name %q", name)
+	}
+	migrations, err := m.Load()
+	if err != nil {
+		return nil, err
+	}
+	previous := []TableDefinition{}
+	if len(migrations) != 0 {
+		previous = migrations[len(migrations)-1].Schema
+	}
+	current, err := s.Definitions()
+	if err != nil {
+		return nil, err
+	}
+	up, err := DiffSchemas(m.driver, previous, current)
+	if err != nil {
+		return nil, err
+	}
+	if len(up) == 0 {
+		return nil, nil
+	}
+	down, err := DiffSchemas(m.driver, current, reverseRenames(previous, current))
+	if err != nil {
+		return nil, err
+	}
+	migration := &Migration{
+		Version: len(migrations) + 1,
+		Name:    name,
+		Up:      up,
+		Down:    down,
+		Schema:  current,
+	}
+	if err := os.MkdirAll(m.dir, 0755); err != nil {
+		return nil, err
+	}
+	base := m.base(migration.Version, name)
+	if err := writeChanges(base+migrationUp, up); err != nil {
+		return nil, err
+	}
+	if err := writeChanges(base+migrationDown, down); err != nil {
+		return nil, err
+	}
+	data, err := json.MarshalIndent(current, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(base+migrationSnapshot, data, 0644); err != nil {
+		return nil, err
+	}
+	return migration, nil
+}
+
+// statements returns the statements of the passed changes.
+func statements(changes []Change) []string {
+	s := make([]string, len(changes))
+	for i := range changes {
+		s[i] = changes[i].Statement
+	}
+	return s
+}
+
+// Replay replays the migrations from an empty schema and returns the
+// resulting one. The changes of each migration are applied to the tables
+// replayed so far, checking that their statements are the ones in the
+// files, that Up turns the tables into the snapshot of the migration and
+// that Down turns them back into the previous one.
+func (m *Migrations) Replay() ([]TableDefinition, error) {
+	migrations, err := m.Load()
+	if err != nil {
+		return nil, err
+	}
+	schema, previous := []TableDefinition{}, []TableDefinition{}
+	for _, migration := range migrations {
+		next, err := m.replay(schema, previous, migration.Schema, migration.Up)
+		if err != nil {
+			return nil, fmt.Errorf("replaying migration %d: %w", migration.Version, err)
+		}
+		if _, err := m.replay(next, migration.Schema, reverseRenames(previous, migration.Schema), migration.Down); err != nil {
+			return nil, fmt.Errorf("reverting migration %d: %w", migration.Version, err)
+		}
+		schema, previous = next, migration.Schema
+	}
+	return schema, nil
+}
+
+// replay applies to tables the changes that turn the snapshot from into
+// to, as built by the diff, checking that their statements are the passed
+// ones and that the result is to.
+func (m *Migrations) replay(tables, from, to []TableDefinition, changes []Change) ([]TableDefinition, error) {
+	diffed, alters, err := diffSchemas(m.driver, from, to)
+	if err != nil {
+		return nil, err
+	}
+	if !reflect.DeepEqual(statements(diffed), statements(changes)) {
+		return nil, fmt.Errorf("the statements are not the ones between the snapshots")
+	}
+	applied, err := applyAlters(m.driver, tables, alters)
+	if err != nil {
+		return nil, err
+	}
+	same, err := sameTables(m.driver, applied, to)
+	if err != nil {
+		return nil, err
+	}
+	if !same {
+		return nil, fmt.Errorf("the statements do not produce the snapshot")
+	}
+	return applied, nil
+}
+
+// cloneTable returns a copy of the passed table that can be changed
+// without changing it.
+func cloneTable(t TableDefinition) TableDefinition {
+	t.Fields = append([]FieldDefinition{}, t.Fields...)
+	t.FKs = append([]FKDefinition{}, t.FKs...)
+	t.PKs = append([]string{}, t.PKs...)
+	t.Uniques = append([]UniqueDefinition{}, t.Uniques...)
+	t.Indexes = append([]IndexDefinition{}, t.Indexes...)
+	return t
+}
+
+// applyAlters returns the passed tables after making the passed changes,
+// which are applied to their definitions as the database would to the
+// tables. A table created holds no indexes nor comments, those are made
+// by the changes that follow it.
+func applyAlters(d SQLDriver, tables []TableDefinition, alters []AlterDefinition) ([]TableDefinition, error) {
+	applied := make([]TableDefinition, len(tables))
+	for i := range tables {
+		applied[i] = cloneTable(tables[i])
+	}
+	for _, alter := range alters {
+		i := -1
+		for j := range applied {
+			if strings.EqualFold(qualifiedName(applied[j].Options.Schema, applied[j].Name), alter.Table) {
+				i = j
+			}
+		}
+		switch {
+		case alter.Kind == AlterCreateTable:
+			if i != -1 {
+				return nil, fmt.Errorf("cannot %s %q: it already exists", alter.Kind, alter.Table)
+			}
+			created := cloneTable(alter.Created)
+			created.Indexes = nil
+			created.Options.Comment = ""
+			for j := range created.Fields {
+				created.Fields[j].Comment = ""
+			}
+			applied = append(applied, created)
+			continue
+		case i == -1:
+			return nil, fmt.Errorf("cannot %s of %q: no such table", alter.Kind, alter.Table)
+		case alter.Kind == AlterDropTable:
+			applied = append(applied[:i], applied[i+1:]...)
+			continue
+		}
+		if err := applyAlter(d, &applied[i], alter); err != nil {
+			return nil, fmt.Errorf("cannot %s %q of %q: %w", alter.Kind, alter.Name, alter.Table, err)
+		}
+	}
+	return applied, nil
+}
+
+// applyAlter makes the passed change, other than creating or dropping it,
+// to the passed table.
+func applyAlter(d SQLDriver, t *TableDefinition, alter AlterDefinition) error {
+	max := d.MaxIdentifierLength()
+	field := -1
+	for i := range t.Fields {
+		if strings.EqualFold(t.Fields[i].Name, alter.Name) {
+			field = i
+		}
+	}
+	switch alter.Kind {
+	case AlterAddColumn:
+		if field != -1 {
+			return fmt.Errorf("the column already exists")
+		}
+		added := alter.Field
+		added.Check, added.CheckName, added.Comment = "", "", ""
+		t.Fields = append(t.Fields, added)
+		return nil
+	case AlterRenameColumn:
+		for i := range t.Fields {
+			if strings.EqualFold(t.Fields[i].Name, alter.OldName) {
+				t.Fields[i].Name = alter.Name
+				return nil
+			}
+		}
+		return fmt.Errorf("no such column %q", alter.OldName)
+	case AlterAddConstraint:
+		c := alter.Constraint
+		if len(c.PKs) != 0 {
+			t.PKs, t.PKName = c.PKs, c.PKName
+		}
+		t.FKs = append(t.FKs, c.FKs...)
+		t.Uniques = append(t.Uniques, c.Uniques...)
+		for _, f := range c.Fields {
+			for i := range t.Fields {
+				if strings.EqualFold(t.Fields[i].Name, f.Name) {
+					t.Fields[i].Check, t.Fields[i].CheckName = f.Check, f.CheckName
+				}
+			}
+		}
+		return nil
+	case AlterDropConstraint:
+		return dropConstraint(t, alter.Name, max)
+	case AlterCreateIndex:
+		t.Indexes = append(t.Indexes, alter.Index)
+		return nil
+	case AlterDropIndex:
+		for i, index := range t.Indexes {
+			if strings.EqualFold(qualifiedName(t.Options.Schema, truncateIdentifier(index.Name, max)), alter.Name) {
+				t.Indexes = append(t.Indexes[:i], t.Indexes[i+1:]...)
+				return nil
+			}
+		}
+		return fmt.Errorf("no such index")
+	case AlterComment:
+		if alter.Name == "" {
+			t.Options.Comment = alter.Definition
+			return nil
+		}
+	}
+	if field == -1 {
+		return fmt.Errorf("no such column")
+	}
+	switch alter.Kind {
+	case AlterDropColumn:
+		t.Fields = append(t.Fields[:field], t.Fields[field+1:]...)
+	case AlterColumnType:
+		t.Fields[field].Type, t.Fields[field].Size = alter.Field.Type, alter.Field.Size
+	case AlterSetDefault, AlterDropDefault:
+		t.Fields[field].Default = alter.Field.Default
+	case AlterComment:
+		t.Fields[field].Comment = alter.Definition
+	default:
+		return fmt.Errorf("unknown change")
+	}
+	return nil
+}
+
+// dropConstraint removes the constraint with the passed name, as truncated
+// to max, from the passed table.
+func dropConstraint(t *TableDefinition, name string, max int) error {
+	named := func(n string) bool {
+		return n != "" && strings.EqualFold(truncateIdentifier(n, max), name)
+	}
+	if named(t.PKName) {
+		t.PKs, t.PKName = nil, ""
+		return nil
+	}
+	for i := range t.FKs {
+		if named(t.FKs[i].Name) {
+			t.FKs = append(t.FKs[:i], t.FKs[i+1:]...)
+			return nil
+		}
+	}
+	for i := range t.Uniques {
+		if named(t.Uniques[i].Name) {
+			t.Uniques = append(t.Uniques[:i], t.Uniques[i+1:]...)
+			return nil
+		}
+	}
+	for i := range t.Fields {
+		if named(t.Fields[i].CheckName) {
+			t.Fields[i].Check, t.Fields[i].CheckName = "", ""
+			return nil
+		}
+	}
+	return fmt.Errorf("no such constraint")
+}
+
+// sameTables returns true if the passed tables are the same for the
+// driver, regardless of the order of the tables, their columns and their
+// named constraints and indexes, that is if they are created by the same
+// statements once sorted.
+func sameTables(d SQLDriver, a, b []TableDefinition) (bool, error) {
+	scriptA, err := sortedScript(d, a)
+	if err != nil {
+		return false, err
+	}
+	scriptB, err := sortedScript(d, b)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(scriptA, scriptB), nil
+}
+
+// sortedScript returns the statements that create the passed tables, with
+// their indexes and comments, from scratch with the tables, their columns,
+// and their constraints and indexes sorted by name.
+func sortedScript(d SQLDriver, tables []TableDefinition) ([]string, error) {
+	sorted := make([]TableDefinition, len(tables))
+	for i := range tables {
+		t := cloneTable(tables[i])
+		sort.SliceStable(t.Fields, func(i, j int) bool {
+			return strings.ToLower(t.Fields[i].Name) < strings.ToLower(t.Fields[j].Name)
+		})
+		sort.SliceStable(t.FKs, func(i, j int) bool {
+			return t.FKs[i].Name < t.FKs[j].Name
+		})
+		sort.SliceStable(t.Uniques, func(i, j int) bool {
+			return t.Uniques[i].Name < t.Uniques[j].Name
+		})
+		sort.SliceStable(t.Indexes, func(i, j int) bool {
+			return t.Indexes[i].Name < t.Indexes[j].Name
+		})
+		sorted[i] = t
+	}
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].Name) < strings.ToLower(sorted[j].Name)
+	})
+	script := []string{}
+	for _, t := range sorted {
+		create, err := CraftCreate(d, t)
+		if err != nil {
+			return nil, err
+		}
+		script = append(script, create)
+		script = append(script, CraftIndexes(d, qualifiedIndexes(t.Options.Schema, t.Indexes))...)
+		comments, err := CraftComments(d, t)
+		if err != nil && !errors.Is(err, ErrNoComments) {
+			return nil, err
+		}
+		script = append(script, comments...)
+	}
+	return script, nil
+}
+
+// Verify replays the migrations and checks that the resulting schema is
+// the one of the passed schema, that is, they produce the same statements
+// regardless of the order of the columns, constraints and indexes.
+func (m *Migrations) Verify(s *Schema) error {
+	replayed, err := m.Replay()
+	if err != nil {
+		return err
+	}
+	current, err := s.Definitions()
+	if err != nil {
+		return err
+	}
+	same, err := sameTables(m.driver, replayed, current)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("the migrations do not produce the current schema, a new one is needed")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// MySQLDriver is a SQLDriver for MySQL, it behaves as the ANSISQLDriver
+// except where the dialect differs.
+type MySQLDriver struct {
+	ANSISQLDriver
+}
+
+const (
+	mysqlTableCommentTemplate = `ALTER TABLE %s COMMENT = %s;`
+	mysqlColumnTypeTemplate   = `ALTER TABLE %s MODIFY COLUMN %s %s;`
+	mysqlDropIndexTemplate    = `DROP INDEX %s ON %s;`
+)
+
+// MaxIdentifierLength implements SQLDriver
+func (*MySQLDriver) MaxIdentifierLength() int {
+	return 64
+}
+
+// DefineAlter implements SQLDriver
+func (d *MySQLDriver) DefineAlter(alter AlterDefinition) (string, error) {
+	switch alter.Kind {
+	case AlterColumnType:
+		return fmt.Sprintf(mysqlColumnTypeTemplate, alter.Table, alter.Name, alter.Definition), nil
+	case AlterDropIndex:
+		// indexes belong to their table, the name is not qualified.
+		name := alter.Name[strings.LastIndex(alter.Name, ".")+1:]
+		return fmt.Sprintf(mysqlDropIndexTemplate, name, alter.Table), nil
+	}
+	return d.ANSISQLDriver.DefineAlter(alter)
+}
+
+// DefineComment implements SQLDriver
+// MySQL comments columns as part of their whole definition, only the
+// comments of tables can be set on their own.
+func (*MySQLDriver) DefineComment(table, column, comment string) (string, error) {
+	if column != "" {
+		return "", ErrNoComments
+	}
+	return fmt.Sprintf(mysqlTableCommentTemplate, table, quoteString(comment)), nil
+}
+
+// DefineTruncate implements SQLDriver
+// MySQL always restarts the AUTO_INCREMENT counter when truncating.
+func (*MySQLDriver) DefineTruncate(table string, opts TruncateOptions) (string, error) {
+	return fmt.Sprintf(baseTruncate, table, ""), nil
+}
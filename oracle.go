@@ -0,0 +1,95 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OracleSQLDriver is a SQLDriver for Oracle, it behaves as the
+// ANSISQLDriver except where the dialect differs.
+type OracleSQLDriver struct {
+	ANSISQLDriver
+}
+
+// MaxIdentifierLength implements SQLDriver
+func (*OracleSQLDriver) MaxIdentifierLength() int {
+	return 30
+}
+
+const (
+	oracleCascade   = " CASCADE CONSTRAINTS"
+	oracleTemporary = "GLOBAL TEMPORARY "
+
+	oracleAddColumnTemplate   = `ALTER TABLE %s ADD (%s);`
+	oracleModifyTemplate      = `ALTER TABLE %s MODIFY (%s %s);`
+	oracleDropDefaultTemplate = `ALTER TABLE %s MODIFY (%s DEFAULT NULL);`
+	oracleFKTemplate          = `FOREIGN KEY (%s) REFERENCES %s (%s)%s`
+	oracleOnDeleteTemplate    = ` ON DELETE %s`
+)
+
+// DefineFK implements SQLDriver, Oracle has no ON UPDATE clause and only
+// takes CASCADE and SET NULL on delete, RESTRICT and NO ACTION are what
+// it does without one.
+func (*OracleSQLDriver) DefineFK(fk FKDefinition) string {
+	onDelete := ""
+	switch fk.OnDelete {
+	case "", FKCascade:
+		onDelete = fmt.Sprintf(oracleOnDeleteTemplate, FKCascade)
+	case FKSetNull:
+		onDelete = fmt.Sprintf(oracleOnDeleteTemplate, FKSetNull)
+	}
+	return fmt.Sprintf(oracleFKTemplate,
+		strings.Join(fk.Names, ", "),
+		fk.RemoteTable,
+		strings.Join(fk.RemoteNames, ", "),
+		onDelete)
+}
+
+// DefineAlter implements SQLDriver
+func (d *OracleSQLDriver) DefineAlter(alter AlterDefinition) (string, error) {
+	switch alter.Kind {
+	case AlterAddColumn:
+		return fmt.Sprintf(oracleAddColumnTemplate, alter.Table, alter.Definition), nil
+	case AlterColumnType, AlterSetDefault:
+		return fmt.Sprintf(oracleModifyTemplate, alter.Table, alter.Name, alter.Definition), nil
+	case AlterDropDefault:
+		return fmt.Sprintf(oracleDropDefaultTemplate, alter.Table, alter.Name), nil
+	}
+	return d.ANSISQLDriver.DefineAlter(alter)
+}
+
+// DefineCreate implements SQLDriver
+func (*OracleSQLDriver) DefineCreate(table TableDefinition, definitions []string) (string, error) {
+	opts := table.Options
+	if opts.IfNotExists {
+		return "", fmt.Errorf("Oracle cannot create a table only if it does not exist")
+	}
+	for _, fk := range table.FKs {
+		if fk.OnDelete == FKSetDefault {
+			return "", fmt.Errorf("Oracle cannot set foreign key %q to its default on delete", fk.Name)
+		}
+	}
+	return fmt.Sprintf(baseCREATE,
+		option(opts.Temporary, oracleTemporary),
+		"",
+		qualifiedName(opts.Schema, table.Name),
+		strings.Join(definitions, ", ")), nil
+}
+
+// DefineDrop implements SQLDriver
+func (*OracleSQLDriver) DefineDrop(table string, opts DropOptions) (string, error) {
+	if opts.IfExists {
+		return "", fmt.Errorf("Oracle cannot drop a table only if it exists")
+	}
+	return fmt.Sprintf(baseDrop, "", table, option(opts.Cascade, oracleCascade)), nil
+}
+
+// DefineTruncate implements SQLDriver
+func (*OracleSQLDriver) DefineTruncate(table string, opts TruncateOptions) (string, error) {
+	if opts.RestartIdentity {
+		return "", fmt.Errorf("Oracle cannot restart identities when truncating")
+	}
+	return fmt.Sprintf(baseTruncate, table, ""), nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// PostgreSQLDriver is a SQLDriver for PostgreSQL, it behaves as the
+// ANSISQLDriver except where the dialect differs.
+type PostgreSQLDriver struct {
+	ANSISQLDriver
+	// IndexIfNotExists makes creating an index that already
+	// exists succeed.
+	IndexIfNotExists bool
+	// IndexMethod is the access method of the indexes, such
+	// as btree or hash, empty for the default one.
+	IndexMethod string
+}
+
+const (
+	pgIndexTemplate      = `CREATE %sINDEX %s%s ON %s%s (%s);`
+	pgColumnTypeTemplate = `ALTER TABLE %s ALTER COLUMN %s TYPE %s;`
+)
+
+// MaxIdentifierLength implements SQLDriver
+func (*PostgreSQLDriver) MaxIdentifierLength() int {
+	return 63
+}
+
+// DefineAlter implements SQLDriver
+func (d *PostgreSQLDriver) DefineAlter(alter AlterDefinition) (string, error) {
+	if alter.Kind == AlterColumnType {
+		return fmt.Sprintf(pgColumnTypeTemplate, alter.Table, alter.Name, alter.Definition), nil
+	}
+	return d.ANSISQLDriver.DefineAlter(alter)
+}
+
+// DefineIndex implements SQLDriver
+func (d *PostgreSQLDriver) DefineIndex(index IndexDefinition) string {
+	var unique, ifNotExists, method string
+	if index.Unique {
+		unique = "UNIQUE "
+	}
+	if d.IndexIfNotExists {
+		ifNotExists = "IF NOT EXISTS "
+	}
+	if d.IndexMethod != "" {
+		method = " USING " + d.IndexMethod
+	}
+	return fmt.Sprintf(pgIndexTemplate, unique, ifNotExists, index.Name, index.Table, method, strings.Join(index.Columns, ", "))
+}
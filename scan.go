@@ -0,0 +1,154 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Scanner is the subset of *sql.Row and *sql.Rows used to read
+// a single row.
+type Scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// Rows is the subset of *sql.Rows used to read many rows.
+type Rows interface {
+	Scanner
+	Next() bool
+	Err() error
+}
+
+// Scan reads a row, obtained with one of the SELECT statements of this
+// marshaller, into out which must be a pointer to the type of this
+// marshaller. Only exported fields can be set.
+// Referenced structs are allocated, if needed, and only their primary
+// keys are set.
+func (s *SQLMarshaller) Scan(row Scanner, out interface{}) error {
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("expected a non nil pointer, got %T", out)
+	}
+	return scanInto(s.tokenized, row, v.Elem())
+}
+
+// ScanChildren reads all the rows, obtained with SelectChildren, into the
+// has many field with the passed name of out, which must be a pointer to the
+// type of this marshaller.
+func (s *SQLMarshaller) ScanChildren(rows Rows, out interface{}, field string) error {
+	f, ok := s.tokenized.hasMany(field)
+	if !ok {
+		return fmt.Errorf("%q has no has many field %q", s.Name(), field)
+	}
+	v := reflect.ValueOf(out)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("expected a non nil pointer, got %T", out)
+	}
+	elems := v.Elem().FieldByName(field)
+	if !elems.CanSet() {
+		return fmt.Errorf("cannot set unexported field %q", field)
+	}
+	for rows.Next() {
+		elem := reflect.New(f.elemType)
+		if err := scanInto(f.many, rows, elem.Elem()); err != nil {
+			return err
+		}
+		if !f.ptrElem {
+			elem = elem.Elem()
+		}
+		elems.Set(reflect.Append(elems, elem))
+	}
+	return rows.Err()
+}
+
+// scanInto reads a row of the tokenized type t into v.
+func scanInto(t *tokenized, row Scanner, v reflect.Value) error {
+	paths, err := t.columnPaths()
+	if err != nil {
+		return err
+	}
+	holders := make([]interface{}, len(paths))
+	for i := range holders {
+		holders[i] = new(interface{})
+	}
+	if err := row.Scan(holders...); err != nil {
+		return fmt.Errorf("scanning row: %w", err)
+	}
+	for i, path := range paths {
+		if path == nil {
+			continue
+		}
+		src := *(holders[i].(*interface{}))
+		// a NULL Foreign Key leaves the reference nil.
+		if src == nil && len(path) > 1 {
+			continue
+		}
+		dst, err := fieldFor(v, path)
+		if err != nil {
+			return err
+		}
+		if err := assign(dst, src); err != nil {
+			return fmt.Errorf("setting %q: %w", strings.Join(path, "."), err)
+		}
+	}
+	return nil
+}
+
+// fieldFor returns the field found by following the passed field names
+// from v, allocating the nil pointers on the way.
+func fieldFor(v reflect.Value, path []string) (reflect.Value, error) {
+	for _, name := range path {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.FieldByName(name)
+		if !v.CanSet() {
+			return reflect.Value{}, fmt.Errorf("cannot set unexported field %q", name)
+		}
+	}
+	return v, nil
+}
+
+// assign sets dst to the value src read from the database converting
+// it, if needed, to the type of dst.
+func assign(dst reflect.Value, src interface{}) error {
+	if src == nil {
+		dst.Set(reflect.Zero(dst.Type()))
+		return nil
+	}
+	if dst.Kind() == reflect.Ptr {
+		elem := reflect.New(dst.Type().Elem())
+		if err := assign(elem.Elem(), src); err != nil {
+			return err
+		}
+		dst.Set(elem)
+		return nil
+	}
+	if b, ok := src.([]byte); ok {
+		src = string(b)
+	}
+	if tm, ok := src.(time.Time); ok && dst.Type() == timeType {
+		dst.Set(reflect.ValueOf(tm))
+		return nil
+	}
+	// drivers might return anything as text.
+	if s, ok := src.(string); ok {
+		return parseInto(dst, s)
+	}
+	sv := reflect.ValueOf(src)
+	switch {
+	case dst.Kind() == reflect.Bool && sv.Kind() == reflect.Int64:
+		dst.SetBool(sv.Int() != 0)
+	case dst.Kind() != reflect.String && sv.Type().ConvertibleTo(dst.Type()):
+		dst.Set(sv.Convert(dst.Type()))
+	default:
+		return fmt.Errorf("cannot assign %T to %v", src, dst.Type())
+	}
+	return nil
+}
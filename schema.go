@@ -0,0 +1,466 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// CycleError is returned when the tables of a schema reference each
+// other through Foreign Keys so there is no order in which they can
+// be created, Tables holds one such cycle starting and ending with
+// the same table.
+type CycleError struct {
+	Tables []string
+}
+
+// Error implements error.
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("foreign key cycle: %s", strings.Join(e.Tables, " -> "))
+}
+
+// Schema is a registry of the marshallers for all the tables of a
+// database, it knows the order in which they have to be created.
+type Schema struct {
+	// cache holds the tokenized form of every struct type seen, so
+	// registered types and the ones they reference are the same.
+	cache  map[reflect.Type]*tokenized
+	tables []*SQLMarshaller
+	namer  ConstraintNamer
+}
+
+// NewSchema returns an empty Schema.
+func NewSchema() *Schema {
+	return &Schema{
+		cache: map[reflect.Type]*tokenized{},
+		namer: DefaultConstraintNamer,
+	}
+}
+
+// SetConstraintNamer sets the naming scheme for the constraints of all
+// the tables in the schema, by default DefaultConstraintNamer.
+func (s *Schema) SetConstraintNamer(namer ConstraintNamer) {
+	s.namer = namer
+	for _, m := range s.tables {
+		m.SetConstraintNamer(namer)
+	}
+}
+
+// Register adds a table to the schema for the passed struct, map or
+// yaml.MapSlice, the same inputs NewTypeSQLMarshaller accepts, structs are named after their
+// type so they match the tables referencing them and name is only used
+// for maps.
+func (s *Schema) Register(in interface{}, name string) (*SQLMarshaller, error) {
+	t := reflect.TypeOf(in)
+	var tokens *tokenized
+	var err error
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice:
+		tokens, err = tokenizeMap(in, name)
+	case reflect.Struct:
+		var ok bool
+		if tokens, ok = s.cache[t]; !ok {
+			tokens, err = tokenizeType(t, t.Name(), s.cache)
+		}
+	default:
+		return nil, fmt.Errorf("Only Map and Struct types are currently supported for marshalling")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("registering %q: %w", name, err)
+	}
+	return s.register(t, tokens)
+}
+
+// register adds a table to the schema for the passed tokenized type.
+func (s *Schema) register(t reflect.Type, tokens *tokenized) (*SQLMarshaller, error) {
+	m := &SQLMarshaller{
+		typeOf:    t,
+		tokenized: tokens,
+		driver:    &ANSISQLDriver{},
+		namer:     s.namer,
+	}
+	if _, ok := s.Marshaller(m.Name()); ok {
+		return nil, fmt.Errorf("table %q: %w", m.Name(), ErrDuplicateTable)
+	}
+	s.tables = append(s.tables, m)
+	s.resolveReferences()
+	return m, nil
+}
+
+// resolveReferences points the Foreign Keys declared in maps to the
+// registered tables they reference, those not yet registered are
+// resolved once they are.
+func (s *Schema) resolveReferences() {
+	for _, m := range s.tables {
+		fields := m.tokenized.fields
+		for i := range fields {
+			if fields[i].referencesName == "" || fields[i].references != nil {
+				continue
+			}
+			table := strings.SplitN(fields[i].referencesName, ".", 2)[0]
+			if remote, ok := s.Marshaller(table); ok {
+				fields[i].references = remote.tokenized
+			}
+		}
+	}
+}
+
+// Marshaller returns the marshaller for the table with the passed name and
+// a bool indicating if it is registered.
+func (s *Schema) Marshaller(name string) (*SQLMarshaller, bool) {
+	for _, m := range s.tables {
+		if m.Name() == name {
+			return m, true
+		}
+	}
+	return nil, false
+}
+
+// dependencies returns the registered tables the passed one holds Foreign
+// Keys to, a table referencing itself does not depend on itself.
+func (s *Schema) dependencies(m *SQLMarshaller) []*SQLMarshaller {
+	deps := []*SQLMarshaller{}
+	add := func(references *tokenized) {
+		if references == m.tokenized {
+			return
+		}
+		for _, d := range s.tables {
+			if d.tokenized == references {
+				deps = append(deps, d)
+			}
+		}
+	}
+	for _, f := range m.tokenized.fields {
+		if f.kind == SqlFK {
+			add(f.references)
+		}
+	}
+	for _, b := range m.tokenized.backRefs {
+		add(b.references)
+	}
+	return deps
+}
+
+// Tables returns the marshallers of the registered tables sorted so every
+// table comes after the ones it references, tables that do not depend on
+// each other keep the order in which they were registered.
+// A *CycleError is returned if the tables reference each other.
+func (s *Schema) Tables() ([]*SQLMarshaller, error) {
+	sorted := make([]*SQLMarshaller, 0, len(s.tables))
+	done := map[*SQLMarshaller]bool{}
+	for len(sorted) < len(s.tables) {
+		progress := false
+		for _, m := range s.tables {
+			if done[m] || !s.ready(m, done) {
+				continue
+			}
+			sorted = append(sorted, m)
+			done[m] = true
+			progress = true
+			break
+		}
+		if !progress {
+			return nil, s.cycle(done)
+		}
+	}
+	return sorted, nil
+}
+
+// ready returns true if all the dependencies of the passed table are done.
+func (s *Schema) ready(m *SQLMarshaller, done map[*SQLMarshaller]bool) bool {
+	for _, d := range s.dependencies(m) {
+		if !done[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// cycle returns a *CycleError for one of the cycles among the tables that
+// are not done, all of them have at least one dependency that is not.
+func (s *Schema) cycle(done map[*SQLMarshaller]bool) error {
+	var m *SQLMarshaller
+	for _, m = range s.tables {
+		if !done[m] {
+			break
+		}
+	}
+	path := []*SQLMarshaller{}
+	seen := map[*SQLMarshaller]int{}
+	for {
+		if at, ok := seen[m]; ok {
+			path = append(path[at:], m)
+			break
+		}
+		seen[m] = len(path)
+		path = append(path, m)
+		for _, d := range s.dependencies(m) {
+			if !done[d] {
+				m = d
+				break
+			}
+		}
+	}
+	names := make([]string, len(path))
+	for i := range path {
+		names[i] = path[i].Name()
+	}
+	return &CycleError{Tables: names}
+}
+
+// Definitions returns the definitions of the registered tables, sorted
+// as Tables does, followed by the ones of their join tables.
+func (s *Schema) Definitions() ([]TableDefinition, error) {
+	tables, err := s.Tables()
+	if err != nil {
+		return nil, err
+	}
+	definitions := make([]TableDefinition, len(tables))
+	for i, m := range tables {
+		if definitions[i], err = m.tokenized.tableDefinition(m.Name(), s.namer); err != nil {
+			return nil, fmt.Errorf("gattering the fields of %q: %w", m.Name(), err)
+		}
+	}
+	joins, err := s.joinTables(tables)
+	if err != nil {
+		return nil, err
+	}
+	return append(definitions, joins...), nil
+}
+
+// joinTables returns the definitions of the join tables of the many to many
+// fields of the passed tables, each only once even if both sides declare it.
+func (s *Schema) joinTables(tables []*SQLMarshaller) ([]TableDefinition, error) {
+	seen := map[string]bool{}
+	joins := []TableDefinition{}
+	for _, m := range tables {
+		for _, f := range m.tokenized.fields {
+			if f.kind != SqlManyToMany || seen[f.joinTable] {
+				continue
+			}
+			seen[f.joinTable] = true
+			join, _, _ := m.tokenized.joinTableOf(f)
+			table, err := join.tableDefinition(f.joinTable, s.namer)
+			if err != nil {
+				return nil, fmt.Errorf("gattering the fields for join table %q: %w", f.joinTable, err)
+			}
+			joins = append(joins, table)
+		}
+	}
+	return joins, nil
+}
+
+// joinTableCreates returns the SQL CREATE statements for the join tables
+// of the passed tables with the passed options.
+func (s *Schema) joinTableCreates(driver SQLDriver, tables []*SQLMarshaller, opts CreateOptions) ([]string, error) {
+	joins, err := s.joinTables(tables)
+	if err != nil {
+		return nil, err
+	}
+	creates := make([]string, len(joins))
+	for i := range joins {
+		joins[i].Options = opts
+		if creates[i], err = CraftCreate(driver, joins[i]); err != nil {
+			return nil, err
+		}
+	}
+	return creates, nil
+}
+
+// indexesAndComments returns the CREATE INDEX statements and the comments
+// of the table of the passed marshaller, comments are left out for dialects
+// that have none, as they are from CREATE statements.
+func indexesAndComments(driver SQLDriver, m *SQLMarshaller, opts CreateOptions) ([]string, error) {
+	statements, err := m.indexes(driver, opts.Schema)
+	if err != nil {
+		return nil, err
+	}
+	comments, err := m.Comments(driver, opts)
+	if err != nil && !errors.Is(err, ErrNoComments) {
+		return nil, err
+	}
+	return append(statements, comments...), nil
+}
+
+// Create returns the SQL statements creating all the registered tables,
+// each followed by its indexes and comments, and then the join tables of the many to
+// many relations. Tables come after the ones they reference, see Tables.
+func (s *Schema) Create(driver SQLDriver) ([]string, error) {
+	return s.CreateWithOptions(driver, CreateOptions{})
+}
+
+// CreateWithOptions is like Create but with the passed options applied to
+// every table, the comment describes a single table so it is rejected.
+func (s *Schema) CreateWithOptions(driver SQLDriver, opts CreateOptions) ([]string, error) {
+	if opts.Comment != "" {
+		return nil, fmt.Errorf("cannot set the same comment to every table")
+	}
+	tables, err := s.Tables()
+	if err != nil {
+		return nil, err
+	}
+	statements := []string{}
+	for _, m := range tables {
+		create, err := m.CreateWithOptions(driver, opts)
+		if err != nil {
+			return nil, fmt.Errorf("creating %q: %w", m.Name(), err)
+		}
+		others, err := indexesAndComments(driver, m, opts)
+		if err != nil {
+			return nil, fmt.Errorf("creating %q: %w", m.Name(), err)
+		}
+		statements = append(statements, create)
+		statements = append(statements, others...)
+	}
+	joins, err := s.joinTableCreates(driver, tables, opts)
+	if err != nil {
+		return nil, err
+	}
+	return append(statements, joins...), nil
+}
+
+// CreateDeferred is like Create but tables are created in the order they
+// were registered and without Foreign Keys, which are added afterwards by
+// ALTER TABLE statements, this works for tables referencing each other.
+func (s *Schema) CreateDeferred(driver SQLDriver) ([]string, error) {
+	return s.CreateDeferredWithOptions(driver, CreateOptions{})
+}
+
+// CreateDeferredWithOptions is like CreateDeferred but with the passed
+// options, as CreateWithOptions.
+func (s *Schema) CreateDeferredWithOptions(driver SQLDriver, opts CreateOptions) ([]string, error) {
+	if opts.Comment != "" {
+		return nil, fmt.Errorf("cannot set the same comment to every table")
+	}
+	statements := []string{}
+	alters := []string{}
+	for _, m := range s.tables {
+		create, fks, err := m.createDeferred(driver, opts)
+		if err != nil {
+			return nil, fmt.Errorf("creating %q: %w", m.Name(), err)
+		}
+		others, err := indexesAndComments(driver, m, opts)
+		if err != nil {
+			return nil, fmt.Errorf("creating %q: %w", m.Name(), err)
+		}
+		statements = append(statements, create)
+		statements = append(statements, others...)
+		alters = append(alters, fks...)
+	}
+	joins, err := s.joinTableCreates(driver, s.tables, opts)
+	if err != nil {
+		return nil, err
+	}
+	statements = append(statements, alters...)
+	return append(statements, joins...), nil
+}
+
+// Drop returns the SQL statements dropping all the registered tables with
+// the passed options in the reverse order of Create, so no table is dropped
+// while referenced. When the tables reference each other their Foreign Keys
+// are dropped first, unless opts.Cascade takes care of them.
+func (s *Schema) Drop(driver SQLDriver, opts DropOptions) ([]string, error) {
+	names, cyclic, err := s.reversed()
+	if err != nil {
+		return nil, err
+	}
+	statements := []string{}
+	if cyclic && !opts.Cascade {
+		if statements, _, err = s.deferredFKs(driver, opts.Schema); err != nil {
+			return nil, err
+		}
+	}
+	for i := range names {
+		drop, err := CraftDrop(driver, names[i], opts)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, drop)
+	}
+	return statements, nil
+}
+
+// Truncate returns the SQL statements removing all the rows of the
+// registered tables with the passed options, in the same order as Drop.
+// When the tables reference each other their Foreign Keys are dropped
+// before and added back after.
+func (s *Schema) Truncate(driver SQLDriver, opts TruncateOptions) ([]string, error) {
+	names, cyclic, err := s.reversed()
+	if err != nil {
+		return nil, err
+	}
+	statements, alters := []string{}, []string{}
+	if cyclic {
+		if statements, alters, err = s.deferredFKs(driver, opts.Schema); err != nil {
+			return nil, err
+		}
+	}
+	for i := range names {
+		truncate, err := CraftTruncate(driver, names[i], opts)
+		if err != nil {
+			return nil, err
+		}
+		statements = append(statements, truncate)
+	}
+	return append(statements, alters...), nil
+}
+
+// deferredFKs returns the statements dropping the Foreign Keys of the
+// registered tables in the passed schema and the ones adding them back,
+// like CreateDeferred does.
+func (s *Schema) deferredFKs(driver SQLDriver, schema string) ([]string, []string, error) {
+	drops, alters := []string{}, []string{}
+	for _, m := range s.tables {
+		table, err := m.tokenized.tableDefinition(m.Name(), m.namer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("gattering the foreign keys of %q: %w", m.Name(), err)
+		}
+		table.Options.Schema = schema
+		for _, fk := range table.FKs {
+			if fk.Name == "" {
+				return nil, nil, fmt.Errorf("cannot drop an unnamed foreign key of %q", m.Name())
+			}
+			drop, err := driver.DefineAlter(AlterDefinition{
+				Kind:  AlterDropConstraint,
+				Table: qualifiedName(schema, m.Name()),
+				Name:  truncateIdentifier(fk.Name, driver.MaxIdentifierLength()),
+			})
+			if err != nil {
+				return nil, nil, fmt.Errorf("dropping the foreign keys of %q: %w", m.Name(), err)
+			}
+			drops = append(drops, drop)
+		}
+		alters = append(alters, CraftAddFKs(driver, table)...)
+	}
+	return drops, alters, nil
+}
+
+// reversed returns the names of the join tables and then the registered
+// ones, in the reverse order they are created, and true if they reference
+// each other so they are in the reverse order of CreateDeferred instead.
+func (s *Schema) reversed() ([]string, bool, error) {
+	cyclic := false
+	tables, err := s.Tables()
+	var cycle *CycleError
+	if errors.As(err, &cycle) {
+		tables, cyclic, err = s.tables, true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	joins, err := s.joinTables(tables)
+	if err != nil {
+		return nil, false, err
+	}
+	names := []string{}
+	for i := len(joins) - 1; i >= 0; i-- {
+		names = append(names, joins[i].Name)
+	}
+	for i := len(tables) - 1; i >= 0; i-- {
+		names = append(names, tables[i].Name())
+	}
+	return names, cyclic, nil
+}
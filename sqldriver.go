@@ -14,14 +14,103 @@ type SQLDriver interface {
 	Define(ANSISQLFieldKind, string) (string, bool)
 
 	// DefineFK returns the definition for a Foreign Key
-	// composed with the field name, the foreign table name
-	// and the pk/pks of the referenced table.
-	DefineFK(string, []string, []string) string
+	// composed with the field names, the foreign table name,
+	// the pk/pks of the referenced table and the referential
+	// actions.
+	DefineFK(FKDefinition) string
 
 	// DefinePK returns the Primary key definition for the
 	// field or fields passed and a boolean indicating if
 	// there is a pk.
 	DefinePK([]string) (string, bool)
+
+	// CurrentTimestamp returns the expression that evaluates
+	// to the current date and time in the database.
+	CurrentTimestamp() string
+
+	// DefineDefault returns the DEFAULT clause for a column
+	// with the passed literal value.
+	DefineDefault(string) string
+
+	// DefineCheck returns the CHECK clause for a column with
+	// the passed expression.
+	DefineCheck(string) string
+
+	// DefineIndex returns the statement that creates the
+	// passed index.
+	DefineIndex(IndexDefinition) string
+
+	// DefineUnique returns the UNIQUE constraint definition
+	// for the passed fields.
+	DefineUnique([]string) string
+
+	// MaxIdentifierLength returns the maximum length of the
+	// identifiers in this dialect, 0 meaning no limit.
+	MaxIdentifierLength() int
+
+	// IsReserved returns true if the passed identifier is a
+	// reserved word in this dialect.
+	IsReserved(string) bool
+
+	// DefineCreate returns the CREATE statement for the passed
+	// table with the passed column and constraint definitions or
+	// error if the dialect cannot express its options.
+	DefineCreate(TableDefinition, []string) (string, error)
+
+	// DefineComment returns the statement that sets the comment
+	// of the passed table, or of one of its columns if the column
+	// is not empty, or error if the dialect has no comments.
+	DefineComment(table, column, comment string) (string, error)
+
+	// DefineAlter returns the statement that makes the passed
+	// change to a table or error if the dialect cannot express it.
+	DefineAlter(AlterDefinition) (string, error)
+
+	// DefineDrop returns the statement that drops the passed
+	// table or error if the dialect cannot express the options.
+	DefineDrop(string, DropOptions) (string, error)
+
+	// DefineTruncate returns the statement that removes all the
+	// rows of the passed table or error if the dialect cannot
+	// express the options.
+	DefineTruncate(string, TruncateOptions) (string, error)
+}
+
+// CreateOptions holds the options for CREATE TABLE statements.
+type CreateOptions struct {
+	// IfNotExists makes creating a table that already exists
+	// succeed.
+	IfNotExists bool
+	// Temporary tables only last as long as the session.
+	Temporary bool
+	// Schema qualifies the name of the table, empty for the
+	// default one.
+	Schema string
+	// Comment describes the table, empty if it has none.
+	Comment string
+}
+
+// DropOptions holds the options for DROP TABLE statements.
+type DropOptions struct {
+	// IfExists makes dropping a table that does not exist
+	// succeed.
+	IfExists bool
+	// Cascade also drops the objects that depend on the table,
+	// such as the Foreign Keys referencing it.
+	Cascade bool
+	// Schema qualifies the name of the table, empty for the
+	// default one.
+	Schema string
+}
+
+// TruncateOptions holds the options for TRUNCATE statements.
+type TruncateOptions struct {
+	// RestartIdentity resets the sequences of the identity
+	// columns of the table.
+	RestartIdentity bool
+	// Schema qualifies the name of the table, empty for the
+	// default one.
+	Schema string
 }
 
 var ansiTypes = map[ANSISQLFieldKind]string{
@@ -40,6 +129,27 @@ var ansiTypes = map[ANSISQLFieldKind]string{
 	SqlDouble:     "DOUBLE",
 	SqlNumeric:    "NUMERIC",
 	SqlDecimal:    "DECIMAL",
+	SqlTimestamp:  "TIMESTAMP",
+}
+
+// ansiReserved holds the reserved words of ANSI SQL that are most
+// likely to be used as identifiers, in lower case.
+var ansiReserved = map[string]bool{
+	"all": true, "and": true, "any": true, "as": true, "between": true,
+	"by": true, "case": true, "check": true, "column": true, "constraint": true,
+	"create": true, "cross": true, "current_date": true, "current_time": true,
+	"current_timestamp": true, "current_user": true, "default": true,
+	"delete": true, "distinct": true, "drop": true, "else": true, "end": true,
+	"except": true, "exists": true, "false": true, "fetch": true, "for": true,
+	"foreign": true, "from": true, "full": true, "grant": true, "group": true,
+	"having": true, "in": true, "inner": true, "insert": true, "intersect": true,
+	"into": true, "is": true, "join": true, "left": true, "like": true,
+	"not": true, "null": true, "of": true, "on": true, "or": true, "order": true,
+	"outer": true, "primary": true, "references": true, "right": true,
+	"select": true, "session_user": true, "set": true, "some": true,
+	"table": true, "then": true, "to": true, "true": true, "union": true,
+	"unique": true, "update": true, "user": true, "using": true, "values": true,
+	"when": true, "where": true, "with": true,
 }
 
 // ANSISQLDriver is the reference implementation of SQLDriver
@@ -49,13 +159,51 @@ type ANSISQLDriver struct {
 
 // customers_services_fk FOREIGN KEY (service_id) REFERENCES services (service_id) ON DELETE CASCADE ON UPDATE CASCADE
 const (
-	baseCREATE = `CREATE TABLE %s (%s);`
+	baseCREATE = `CREATE %sTABLE %s%s (%s);`
 	baseInsert = `INSERT INTO %s (%s) VALUES (%s);`
 	baseUpdate = `UPDATE %s SET %s WHERE %s;`
+	baseDelete = `DELETE FROM %s WHERE %s;`
+	baseSelect = `SELECT %s FROM %s;`
+	baseDrop   = `DROP TABLE %s%s%s;`
+
+	baseTruncate    = `TRUNCATE TABLE %s%s;`
+	ifExists        = "IF EXISTS "
+	cascade         = " CASCADE"
+	restartIdentity = " RESTART IDENTITY"
+	temporary       = "TEMPORARY "
+	ifNotExists     = "IF NOT EXISTS "
+
+	addColumnTemplate      = `ALTER TABLE %s ADD COLUMN %s;`
+	dropColumnTemplate     = `ALTER TABLE %s DROP COLUMN %s;`
+	renameColumnTemplate   = `ALTER TABLE %s RENAME COLUMN %s TO %s;`
+	columnTypeTemplate     = `ALTER TABLE %s ALTER COLUMN %s SET DATA TYPE %s;`
+	setDefaultTemplate     = `ALTER TABLE %s ALTER COLUMN %s SET %s;`
+	dropDefaultTemplate    = `ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT;`
+	dropConstraintTemplate = `ALTER TABLE %s DROP CONSTRAINT %s;`
+	dropIndexTemplate      = `DROP INDEX %s;`
 
-	fkTemplate   = `FOREIGN KEY (%s) REFERENCES %s (%s) ON DELETE CASCADE ON UPDATE CASCADE`
+	tableCommentTemplate  = `COMMENT ON TABLE %s IS %s;`
+	columnCommentTemplate = `COMMENT ON COLUMN %s.%s IS %s;`
+
+	baseSelectWhere = `SELECT %s FROM %s WHERE %s;`
+
+	fkTemplate   = `FOREIGN KEY (%s) REFERENCES %s (%s) ON DELETE %s ON UPDATE %s`
 	pkTemplate   = `PRIMARY KEY (%s)`
+	uqTemplate   = `UNIQUE (%s)`
 	baseTemplate = `%s %s`
+	sizeTemplate = `%s(%d)`
+
+	defaultTemplate = `DEFAULT %s`
+	checkTemplate   = `CHECK (%s)`
+
+	constraintTemplate = `CONSTRAINT %s %s`
+	alterAddTemplate   = `ALTER TABLE %s ADD %s;`
+
+	indexTemplate       = `CREATE INDEX %s ON %s (%s);`
+	uniqueIndexTemplate = `CREATE UNIQUE INDEX %s ON %s (%s);`
+
+	sqlNull             = "NULL"
+	sqlCurrentTimestamp = "CURRENT_TIMESTAMP"
 )
 
 // Type implements SQLDriver.
@@ -69,10 +217,18 @@ func (*ANSISQLDriver) Define(k ANSISQLFieldKind, name string) (string, bool) {
 }
 
 // DefineFK implements SQLDriver
-func (*ANSISQLDriver) DefineFK(referenceName string, fieldNames, referenceFields []string) string {
-	referenceField := strings.Join(referenceFields, ", ")
-	localFieldNames := strings.Join(fieldNames, ", ")
-	return fmt.Sprintf(fkTemplate, localFieldNames, referenceName, referenceField)
+// Missing referential actions are taken as CASCADE.
+func (*ANSISQLDriver) DefineFK(fk FKDefinition) string {
+	referenceField := strings.Join(fk.RemoteNames, ", ")
+	localFieldNames := strings.Join(fk.Names, ", ")
+	onDelete, onUpdate := fk.OnDelete, fk.OnUpdate
+	if onDelete == "" {
+		onDelete = FKCascade
+	}
+	if onUpdate == "" {
+		onUpdate = FKCascade
+	}
+	return fmt.Sprintf(fkTemplate, localFieldNames, fk.RemoteTable, referenceField, onDelete, onUpdate)
 }
 
 // DefinePK implements SQLDriver
@@ -83,36 +239,255 @@ func (*ANSISQLDriver) DefinePK(pkFields []string) (string, bool) {
 	return fmt.Sprintf(pkTemplate, strings.Join(pkFields, " ,")), true
 }
 
-// CraftCreate will take the name of the type, the fields, fks and pks information and
-// craft a valid CREATE statement.
-func CraftCreate(d SQLDriver, typeName string, fields []FieldDefinition, fks []FKDefinition, pks []string) (string, error) {
+// CurrentTimestamp implements SQLDriver
+func (*ANSISQLDriver) CurrentTimestamp() string {
+	return sqlCurrentTimestamp
+}
+
+// DefineDefault implements SQLDriver
+func (*ANSISQLDriver) DefineDefault(value string) string {
+	return fmt.Sprintf(defaultTemplate, value)
+}
+
+// DefineCheck implements SQLDriver
+func (*ANSISQLDriver) DefineCheck(expression string) string {
+	return fmt.Sprintf(checkTemplate, expression)
+}
+
+// DefineIndex implements SQLDriver
+func (*ANSISQLDriver) DefineIndex(index IndexDefinition) string {
+	template := indexTemplate
+	if index.Unique {
+		template = uniqueIndexTemplate
+	}
+	return fmt.Sprintf(template, index.Name, index.Table, strings.Join(index.Columns, ", "))
+}
+
+// DefineUnique implements SQLDriver
+func (*ANSISQLDriver) DefineUnique(fields []string) string {
+	return fmt.Sprintf(uqTemplate, strings.Join(fields, ", "))
+}
+
+// MaxIdentifierLength implements SQLDriver
+func (*ANSISQLDriver) MaxIdentifierLength() int {
+	return 128
+}
+
+// DefineCreate implements SQLDriver
+func (*ANSISQLDriver) DefineCreate(table TableDefinition, definitions []string) (string, error) {
+	opts := table.Options
+	return fmt.Sprintf(baseCREATE,
+		option(opts.Temporary, temporary),
+		option(opts.IfNotExists, ifNotExists),
+		qualifiedName(opts.Schema, table.Name),
+		strings.Join(definitions, ", ")), nil
+}
+
+// DefineComment implements SQLDriver
+func (*ANSISQLDriver) DefineComment(table, column, comment string) (string, error) {
+	if column == "" {
+		return fmt.Sprintf(tableCommentTemplate, table, quoteString(comment)), nil
+	}
+	return fmt.Sprintf(columnCommentTemplate, table, column, quoteString(comment)), nil
+}
+
+// qualifiedName returns the name of the passed table qualified by
+// the passed schema, if any.
+func qualifiedName(schema, table string) string {
+	if schema == "" {
+		return table
+	}
+	return schema + "." + table
+}
+
+// qualifiedFK returns the passed Foreign Key referencing its table in the
+// passed schema, tables are taken to reference tables of their schema.
+func qualifiedFK(schema string, fk FKDefinition) FKDefinition {
+	fk.RemoteTable = qualifiedName(schema, fk.RemoteTable)
+	return fk
+}
+
+// qualifiedIndexes returns the passed indexes on their tables in the
+// passed schema.
+func qualifiedIndexes(schema string, indexes []IndexDefinition) []IndexDefinition {
+	qualified := make([]IndexDefinition, len(indexes))
+	for i, index := range indexes {
+		index.Table = qualifiedName(schema, index.Table)
+		qualified[i] = index
+	}
+	return qualified
+}
+
+// quoteString returns the passed string as a SQL string literal.
+func quoteString(s string) string {
+	return "'" + strings.Replace(s, "'", "''", -1) + "'"
+}
+
+// DefineAlter implements SQLDriver
+func (*ANSISQLDriver) DefineAlter(alter AlterDefinition) (string, error) {
+	switch alter.Kind {
+	case AlterAddColumn:
+		return fmt.Sprintf(addColumnTemplate, alter.Table, alter.Definition), nil
+	case AlterDropColumn:
+		return fmt.Sprintf(dropColumnTemplate, alter.Table, alter.Name), nil
+	case AlterRenameColumn:
+		return fmt.Sprintf(renameColumnTemplate, alter.Table, alter.OldName, alter.Name), nil
+	case AlterColumnType:
+		return fmt.Sprintf(columnTypeTemplate, alter.Table, alter.Name, alter.Definition), nil
+	case AlterSetDefault:
+		return fmt.Sprintf(setDefaultTemplate, alter.Table, alter.Name, alter.Definition), nil
+	case AlterDropDefault:
+		return fmt.Sprintf(dropDefaultTemplate, alter.Table, alter.Name), nil
+	case AlterAddConstraint:
+		return fmt.Sprintf(alterAddTemplate, alter.Table, alter.Definition), nil
+	case AlterDropConstraint:
+		return fmt.Sprintf(dropConstraintTemplate, alter.Table, alter.Name), nil
+	case AlterDropIndex:
+		return fmt.Sprintf(dropIndexTemplate, alter.Name), nil
+	}
+	return "", fmt.Errorf("cannot %s", alter.Kind)
+}
+
+// DefineDrop implements SQLDriver
+func (*ANSISQLDriver) DefineDrop(table string, opts DropOptions) (string, error) {
+	return fmt.Sprintf(baseDrop, option(opts.IfExists, ifExists), table, option(opts.Cascade, cascade)), nil
+}
+
+// DefineTruncate implements SQLDriver
+func (*ANSISQLDriver) DefineTruncate(table string, opts TruncateOptions) (string, error) {
+	return fmt.Sprintf(baseTruncate, table, option(opts.RestartIdentity, restartIdentity)), nil
+}
+
+// option returns the passed clause if set is true, an empty string
+// otherwise.
+func option(set bool, clause string) string {
+	if !set {
+		return ""
+	}
+	return clause
+}
+
+// IsReserved implements SQLDriver
+func (*ANSISQLDriver) IsReserved(identifier string) bool {
+	return ansiReserved[strings.ToLower(identifier)]
+}
+
+// constraint prepends the CONSTRAINT clause to the passed constraint
+// definition if name is not empty, truncating the name to the length
+// the driver supports.
+func constraint(d SQLDriver, name, definition string) string {
+	if name == "" {
+		return definition
+	}
+	return fmt.Sprintf(constraintTemplate, truncateIdentifier(name, d.MaxIdentifierLength()), definition)
+}
+
+// CraftCreate will take the definition of a table, that is the fields, fks,
+// pks and uniques information and craft a valid CREATE statement.
+func CraftCreate(d SQLDriver, table TableDefinition) (string, error) {
+	typeName, fields := table.Name, table.Fields
 	if len(fields) == 0 {
 		return "", fmt.Errorf("the table %q has no fields", typeName)
 	}
 	fieldDefinitions := make([]string, len(fields))
 	for i, f := range fields {
-		definition, ok := d.Define(f.Type, f.Name)
-		if !ok {
-			return "", fmt.Errorf("cannot determine an SQL Definition for field %q in the provided driver")
+		definition, err := columnDefinition(d, f)
+		if err != nil {
+			return "", err
+		}
+		if f.Check != "" {
+			definition = fmt.Sprintf(baseTemplate, definition, constraint(d, f.CheckName, d.DefineCheck(f.Check)))
 		}
 		fieldDefinitions[i] = definition
 	}
 
-	fkDefinitions := make([]string, len(fks))
-	for i, f := range fks {
-		definition := d.DefineFK(f.RemoteTable, f.Names, f.RemoteNames)
-		fkDefinitions[i] = definition
+	fkDefinitions := make([]string, len(table.FKs))
+	for i, f := range table.FKs {
+		definition := d.DefineFK(qualifiedFK(table.Options.Schema, f))
+		fkDefinitions[i] = constraint(d, f.Name, definition)
 	}
 	if len(fkDefinitions) != 0 {
 		fieldDefinitions = append(fieldDefinitions, fkDefinitions...)
 	}
 
-	pkDefinition, ok := d.DefinePK(pks)
+	pkDefinition, ok := d.DefinePK(table.PKs)
 	if ok {
-		fieldDefinitions = append(fieldDefinitions, pkDefinition)
+		fieldDefinitions = append(fieldDefinitions, constraint(d, table.PKName, pkDefinition))
+	}
+
+	for _, u := range table.Uniques {
+		fieldDefinitions = append(fieldDefinitions, constraint(d, u.Name, d.DefineUnique(u.Columns)))
 	}
 
-	return fmt.Sprintf(baseCREATE, typeName, strings.Join(fieldDefinitions, ", ")), nil
+	return d.DefineCreate(table, fieldDefinitions)
+}
+
+// sizedKinds holds the kinds that take a size, the length of character
+// and bit strings and the precision of numbers.
+var sizedKinds = map[ANSISQLFieldKind]bool{
+	SqlChar:       true,
+	SqlVarchar:    true,
+	SqlNchar:      true,
+	SqlNVarchar:   true,
+	SqlBit:        true,
+	SqlBitVarying: true,
+	SqlFloat:      true,
+	SqlNumeric:    true,
+	SqlDecimal:    true,
+}
+
+// typeDefinition returns the definition of the passed column, its name
+// and type with the size if it has one, in the passed driver.
+func typeDefinition(d SQLDriver, f FieldDefinition) (string, error) {
+	definition, ok := d.Define(f.Type, f.Name)
+	if !ok {
+		return "", &ErrUnsupportedType{Field: f.Name, Type: f.Type}
+	}
+	if f.Size > 0 {
+		if !sizedKinds[f.Type] {
+			return "", fmt.Errorf("field %q of type %s cannot have a size", f.Name, ansiTypes[f.Type])
+		}
+		definition = fmt.Sprintf(sizeTemplate, definition, f.Size)
+	}
+	return definition, nil
+}
+
+// columnDefinition returns the definition of the passed column, its type
+// and default, in the passed driver.
+func columnDefinition(d SQLDriver, f FieldDefinition) (string, error) {
+	definition, err := typeDefinition(d, f)
+	if err != nil {
+		return "", err
+	}
+	if f.Default != "" {
+		definition = fmt.Sprintf(baseTemplate, definition, d.DefineDefault(f.Default))
+	}
+	return definition, nil
+}
+
+// CraftComments will take the definition of a table and craft a statement
+// setting its comment and one for each of its columns with a comment.
+func CraftComments(d SQLDriver, table TableDefinition) ([]string, error) {
+	name := qualifiedName(table.Options.Schema, table.Name)
+	statements := []string{}
+	if table.Options.Comment != "" {
+		comment, err := d.DefineComment(name, "", table.Options.Comment)
+		if err != nil {
+			return nil, fmt.Errorf("commenting %q: %w", table.Name, err)
+		}
+		statements = append(statements, comment)
+	}
+	for _, f := range table.Fields {
+		if f.Comment == "" {
+			continue
+		}
+		comment, err := d.DefineComment(name, f.Name, f.Comment)
+		if err != nil {
+			return nil, fmt.Errorf("commenting %q: %w", table.Name, err)
+		}
+		statements = append(statements, comment)
+	}
+	return statements, nil
 }
 
 // CraftInsert will take a FieldsWithValue and returns the corresponding INSERT
@@ -129,3 +504,66 @@ func CraftUpdate(typeName string, conditions, fields *FieldsWithValue) string {
 	conditionalPairs := conditions.Pairs("=")
 	return fmt.Sprintf(baseUpdate, typeName, strings.Join(fieldPairs, ", "), strings.Join(conditionalPairs, " AND "))
 }
+
+// CraftDelete will take conditions and craft a delete with them.
+func CraftDelete(typeName string, conditions *FieldsWithValue) string {
+	conditionalPairs := conditions.Pairs("=")
+	return fmt.Sprintf(baseDelete, typeName, strings.Join(conditionalPairs, " AND "))
+}
+
+// CraftSelect will take the columns to be returned and the conditions, which
+// are joined with AND, and craft a select with them.
+func CraftSelect(typeName string, columns, conditions []string) string {
+	if len(conditions) == 0 {
+		return fmt.Sprintf(baseSelect, strings.Join(columns, ", "), typeName)
+	}
+	return fmt.Sprintf(baseSelectWhere, strings.Join(columns, ", "), typeName, strings.Join(conditions, " AND "))
+}
+
+// CraftDrop will take the name of a table and craft a drop for it
+// with the passed options.
+func CraftDrop(d SQLDriver, typeName string, opts DropOptions) (string, error) {
+	drop, err := d.DefineDrop(qualifiedName(opts.Schema, typeName), opts)
+	if err != nil {
+		return "", fmt.Errorf("dropping %q: %w", typeName, err)
+	}
+	return drop, nil
+}
+
+// CraftTruncate will take the name of a table and craft a statement
+// removing all of its rows with the passed options.
+func CraftTruncate(d SQLDriver, typeName string, opts TruncateOptions) (string, error) {
+	truncate, err := d.DefineTruncate(qualifiedName(opts.Schema, typeName), opts)
+	if err != nil {
+		return "", fmt.Errorf("truncating %q: %w", typeName, err)
+	}
+	return truncate, nil
+}
+
+// CraftIndexes will take the index definitions of a table and craft
+// a CREATE INDEX statement for each of them.
+func CraftIndexes(d SQLDriver, indexes []IndexDefinition) []string {
+	statements := make([]string, len(indexes))
+	for i := range indexes {
+		statements[i] = defineIndex(d, indexes[i])
+	}
+	return statements
+}
+
+// defineIndex returns the statement that creates the passed index with its
+// name truncated to the maximum length of the identifiers of the driver.
+func defineIndex(d SQLDriver, index IndexDefinition) string {
+	index.Name = truncateIdentifier(index.Name, d.MaxIdentifierLength())
+	return d.DefineIndex(index)
+}
+
+// CraftAddFKs will take the definition of a table and craft an ALTER TABLE
+// statement adding each of its Foreign Keys.
+func CraftAddFKs(d SQLDriver, table TableDefinition) []string {
+	name := qualifiedName(table.Options.Schema, table.Name)
+	statements := make([]string, len(table.FKs))
+	for i, f := range table.FKs {
+		statements[i] = fmt.Sprintf(alterAddTemplate, name, constraint(d, f.Name, d.DefineFK(qualifiedFK(table.Options.Schema, f))))
+	}
+	return statements
+}
@@ -0,0 +1,76 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SQLiteDriver is a SQLDriver for SQLite, it behaves as the
+// ANSISQLDriver except where the dialect differs.
+type SQLiteDriver struct {
+	ANSISQLDriver
+}
+
+// sqliteTruncate is the statement used instead of TRUNCATE, which
+// SQLite does not have, it is optimized to the same effect.
+const sqliteTruncate = `DELETE FROM %s;`
+
+// MaxIdentifierLength implements SQLDriver
+func (*SQLiteDriver) MaxIdentifierLength() int {
+	return 0
+}
+
+// DefineAlter implements SQLDriver
+// SQLite can only add, drop and rename columns, other changes need
+// the table to be created again.
+func (d *SQLiteDriver) DefineAlter(alter AlterDefinition) (string, error) {
+	switch alter.Kind {
+	case AlterAddColumn, AlterDropColumn, AlterRenameColumn, AlterDropIndex:
+		return d.ANSISQLDriver.DefineAlter(alter)
+	}
+	return "", fmt.Errorf("SQLite cannot %s", alter.Kind)
+}
+
+// DefineCreate implements SQLDriver
+// SQLite takes the schema, an attached database, in the name of the table
+// but not in the ones it references, so tables cannot be created in one.
+func (d *SQLiteDriver) DefineCreate(table TableDefinition, definitions []string) (string, error) {
+	if table.Options.Schema != "" {
+		return "", fmt.Errorf("SQLite cannot reference tables in schema %q", table.Options.Schema)
+	}
+	return d.ANSISQLDriver.DefineCreate(table, definitions)
+}
+
+// DefineIndex implements SQLDriver
+// SQLite qualifies the name of the index with the schema of the table
+// instead of the table.
+func (d *SQLiteDriver) DefineIndex(index IndexDefinition) string {
+	if dot := strings.LastIndex(index.Table, "."); dot >= 0 {
+		index.Name = index.Table[:dot+1] + index.Name
+		index.Table = index.Table[dot+1:]
+	}
+	return d.ANSISQLDriver.DefineIndex(index)
+}
+
+// DefineComment implements SQLDriver
+func (*SQLiteDriver) DefineComment(table, column, comment string) (string, error) {
+	return "", ErrNoComments
+}
+
+// DefineDrop implements SQLDriver
+func (*SQLiteDriver) DefineDrop(table string, opts DropOptions) (string, error) {
+	if opts.Cascade {
+		return "", fmt.Errorf("SQLite cannot drop tables in cascade")
+	}
+	return fmt.Sprintf(baseDrop, option(opts.IfExists, ifExists), table, ""), nil
+}
+
+// DefineTruncate implements SQLDriver
+func (*SQLiteDriver) DefineTruncate(table string, opts TruncateOptions) (string, error) {
+	if opts.RestartIdentity {
+		return "", fmt.Errorf("SQLite cannot restart identities when truncating")
+	}
+	return fmt.Sprintf(sqliteTruncate, table), nil
+}
@@ -3,9 +3,13 @@
 package sqlmarshal
 
 import (
+	"errors"
 	"fmt"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // ANSISQLFieldKind represents any SQL kind that is currently supported.
@@ -34,37 +38,260 @@ const (
 	SqlDouble
 	SqlNumeric
 	SqlDecimal
+
+	// Date and time
+	SqlTimestamp
+
+	// Relations that are not held in a column.
+	SqlHasMany
+	SqlManyToMany
 )
 
+// timeType is the reflected type of time.Time, which is a struct
+// but must not be treated as a Foreign Key.
+var timeType = reflect.TypeOf(time.Time{})
+
+// timestampLayout is the format used to render time.Time values.
+const timestampLayout = "2006-01-02 15:04:05"
+
 // tokenizedField holds the name of a struct field and its
 // sql type.
 type tokenizedField struct {
-	name     string
-	kind     ANSISQLFieldKind
-	goType   reflect.Kind
-	isPk     bool
-	isUnique bool
-	// TODO (perrito666) implement here a way to recursively tokenize for fk
+	name string
+	// field is the name of the struct field holding the column,
+	// which is also the name of the column unless tagged with
+	// another one, it is empty for map based schemas.
+	field     string
+	kind      ANSISQLFieldKind
+	goType    reflect.Kind
+	isPk      bool
+	isUnique  bool
+	isVersion bool
+	// isNullable is true for fields that are pointers to non struct
+	// types, a nil value for those is rendered as NULL.
+	isNullable   bool
+	isSoftDelete bool
+	isCreated    bool
+	isUpdated    bool
+	// defaultValue holds the DEFAULT for the column already
+	// rendered as a literal.
+	defaultValue string
+	check        string
+	comment      string
+	// renamedFrom is the previous name of the field, see Diff.
+	renamedFrom string
+	// size is the length or precision of the column, zero for the
+	// default of the driver.
+	size    int
+	indexes []fieldIndex
+	// references is the tokenized type of a Foreign Key, it can
+	// be the same tokenized holding this field or one that
+	// references it back.
+	references *tokenized
+	// referencesName is the "table" or "table.column" a Foreign Key
+	// declared in a map references, resolved into references by the
+	// Schema it is registered in.
+	referencesName string
+	onDelete       FKAction
+	onUpdate       FKAction
+	// elemType is the struct type of the elements of a has many
+	// field, ptrElem indicates if they are pointers to it.
+	elemType reflect.Type
+	ptrElem  bool
+	// many is the tokenized type of the elements of a has
+	// many field.
+	many *tokenized
+	// backref is the name of the Foreign Key that the elements
+	// of a has many field hold back to this one.
+	backref string
+	// joinTable is the name of the table holding the links of
+	// a many to many field.
+	joinTable string
+}
+
+// backReference is a Foreign Key held by a type on behalf of a
+// has many field of the referenced one.
+type backReference struct {
+	name       string
 	references *tokenized
 }
 
+// fieldIndex holds the name of an index a field is part of, the
+// name is empty for single column indexes named after the field.
+type fieldIndex struct {
+	name   string
+	unique bool
+}
+
 // tokenized holds a set of fields of a given struct and
 // its sql types.
 type tokenized struct {
 	name   string
 	fields []tokenizedField
+	// backRefs are the Foreign Keys to the types that have
+	// many of this one.
+	backRefs []backReference
+}
+
+// pkColumn is a column that is part of a primary key, path holds the
+// names of the fields leading to its value, more than one for primary
+// keys that are Foreign Keys themselves.
+type pkColumn struct {
+	name string
+	kind ANSISQLFieldKind
+	size int
+	path []string
+}
+
+// fkColumnName returns the name of the column that holds the remote
+// column of a Foreign Key held in field.
+func fkColumnName(field, remote string) string {
+	return fmt.Sprintf("%s_%s_fk", field, remote)
+}
+
+// checkReferences returns an error if f is a Foreign Key declared in a
+// map whose table is not known, see Schema.
+func (f tokenizedField) checkReferences(table string) error {
+	if f.references == nil {
+		return &MapSchemaError{
+			Table: table,
+			Field: f.name,
+			Key:   "references",
+			Err:   fmt.Errorf("table %q is not registered", strings.SplitN(f.referencesName, ".", 2)[0]),
+		}
+	}
+	return nil
+}
+
+// primaryColumns returns the columns that hold the primary key of this
+// tokenized type, the primary keys that are Foreign Keys are expanded
+// into the columns referencing the primary key of the other type.
+func (t *tokenized) primaryColumns() ([]pkColumn, error) {
+	return t.primaryColumnsVisiting(map[*tokenized]bool{})
+}
+
+// primaryColumnsVisiting is primaryColumns keeping track of the types
+// being expanded to fail on primary keys that reference themselves.
+func (t *tokenized) primaryColumnsVisiting(visiting map[*tokenized]bool) ([]pkColumn, error) {
+	if visiting[t] {
+		return nil, fmt.Errorf("the primary key of %q references itself", t.name)
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	columns := []pkColumn{}
+	for _, f := range t.fields {
+		if !f.isPk {
+			continue
+		}
+		if f.kind != SqlFK {
+			columns = append(columns, pkColumn{name: f.name, kind: f.kind, size: f.size, path: []string{f.field}})
+			continue
+		}
+		if err := f.checkReferences(t.name); err != nil {
+			return nil, err
+		}
+		remote, err := f.references.primaryColumnsVisiting(visiting)
+		if err != nil {
+			return nil, err
+		}
+		if len(remote) == 0 {
+			return nil, fmt.Errorf("primary key %q of %q references %q which has %w", f.name, t.name, f.references.name, ErrNoPrimaryKey)
+		}
+		for _, c := range remote {
+			columns = append(columns, pkColumn{
+				name: fkColumnName(f.name, c.name),
+				kind: c.kind,
+				size: c.size,
+				path: append([]string{f.field}, c.path...),
+			})
+		}
+	}
+	return columns, nil
 }
 
-// primary returns a slice of the names for the fields that are
+// primary returns a slice of the names for the columns that are
 // considered primary keys.
-func (t *tokenized) primary() []string {
-	primary := []string{}
+func (t *tokenized) primary() ([]string, error) {
+	columns, err := t.primaryColumns()
+	if err != nil {
+		return nil, err
+	}
+	primary := make([]string, len(columns))
+	for i := range columns {
+		primary[i] = columns[i].name
+	}
+	return primary, nil
+}
+
+// version returns the field used for optimistic locking and a boolean
+// indicating if this tokenized type has one.
+func (t *tokenized) version() (tokenizedField, bool) {
+	for _, f := range t.fields {
+		if f.isVersion {
+			return f, true
+		}
+	}
+	return tokenizedField{}, false
+}
+
+// softDelete returns the field that marks rows as deleted and a boolean
+// indicating if this tokenized type has one.
+func (t *tokenized) softDelete() (tokenizedField, bool) {
 	for _, f := range t.fields {
-		if f.isPk {
-			primary = append(primary, f.name)
+		if f.isSoftDelete {
+			return f, true
 		}
 	}
-	return primary
+	return tokenizedField{}, false
+}
+
+// timestamps returns the fields that hold the creation and last update
+// time of a row, either can be empty if this tokenized type has none.
+func (t *tokenized) timestamps() (created, updated string) {
+	for _, f := range t.fields {
+		if f.isCreated {
+			created = f.name
+		}
+		if f.isUpdated {
+			updated = f.name
+		}
+	}
+	return created, updated
+}
+
+// deletedValue returns the value that marks a row as deleted for
+// this soft delete field, now is used for timestamps.
+func (f tokenizedField) deletedValue(now string) string {
+	if f.kind == SqlTimestamp {
+		return now
+	}
+	return "1"
+}
+
+// notDeletedCondition returns the condition that only matches rows
+// not marked as deleted by this soft delete field.
+func (f tokenizedField) notDeletedCondition() string {
+	switch {
+	case f.kind == SqlTimestamp:
+		return fmt.Sprintf("%s IS %s", f.name, sqlNull)
+	case f.isNullable:
+		return fmt.Sprintf("(%s IS %s OR %s=0)", f.name, sqlNull, f.name)
+	}
+	return fmt.Sprintf("%s=0", f.name)
+}
+
+// columns returns the names of all the columns of this tokenized type.
+func (t *tokenized) columns() ([]string, error) {
+	fields, _, _, err := t.fieldsAndTypes()
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]string, len(fields))
+	for i := range fields {
+		columns[i] = fields[i].Name
+	}
+	return columns, nil
 }
 
 // define is a convenience function that returns the SQL definition for the given field
@@ -76,7 +303,7 @@ func define(kind ANSISQLFieldKind, name string, driver, fallback SQLDriver) (str
 		definition, ok = fallback.Define(kind, name)
 	}
 	if !ok {
-		return "", fmt.Errorf("cannot determine an SQL Definition for field %q in the provided driver or the Fallback driver")
+		return "", &ErrUnsupportedType{Field: name, Type: kind}
 	}
 	return definition, nil
 
@@ -96,12 +323,85 @@ func (t *tokenized) fieldKind(name string) (ANSISQLFieldKind, bool) {
 type FieldDefinition struct {
 	Name string
 	Type ANSISQLFieldKind
+	// Default is the literal value for the DEFAULT of the column,
+	// empty if it has none.
+	Default string
+	// Check is the expression for the CHECK constraint of the
+	// column, empty if it has none.
+	Check     string
+	CheckName string
+	// Comment describes the column, empty if it has none.
+	Comment string
+	// RenamedFrom is the previous name of the column, empty if
+	// it was not renamed.
+	RenamedFrom string
+	// Size is the length or precision of the column, zero for the
+	// default of the driver.
+	Size int
+	// Nullable columns accept NULL values.
+	Nullable bool
+}
+
+// UniqueDefinition describes a UNIQUE constraint over one or
+// more columns of a table.
+type UniqueDefinition struct {
+	Name    string
+	Columns []string
+}
+
+// TableDefinition holds all that is needed to craft the CREATE
+// statement of a table, constraints with no name are anonymous.
+type TableDefinition struct {
+	Name    string
+	Fields  []FieldDefinition
+	FKs     []FKDefinition
+	PKs     []string
+	PKName  string
+	Uniques []UniqueDefinition
+	// Indexes are not part of the CREATE statement but of the
+	// definition of the table, see CraftIndexes.
+	Indexes []IndexDefinition
+	Options CreateOptions
+}
+
+// IndexDefinition describes a secondary index over one or more
+// columns of a table.
+type IndexDefinition struct {
+	Name    string
+	Table   string
+	Columns []string
+	Unique  bool
+}
+
+// FKAction is the referential action taken on the referencing rows
+// when the referenced one is deleted or updated.
+type FKAction string
+
+const (
+	FKCascade    FKAction = "CASCADE"
+	FKRestrict   FKAction = "RESTRICT"
+	FKNoAction   FKAction = "NO ACTION"
+	FKSetNull    FKAction = "SET NULL"
+	FKSetDefault FKAction = "SET DEFAULT"
+)
+
+// fkActions maps the values accepted by the ondelete and onupdate
+// tags to their FKAction.
+var fkActions = map[string]FKAction{
+	"cascade":    FKCascade,
+	"restrict":   FKRestrict,
+	"noaction":   FKNoAction,
+	"setnull":    FKSetNull,
+	"setdefault": FKSetDefault,
 }
 
 type FKDefinition struct {
+	Name        string
 	Names       []string
 	RemoteNames []string
 	RemoteTable string
+	OnDelete    FKAction
+	OnUpdate    FKAction
 }
 
 // fieldsAndTypes three slices containing, field definitions, foreign key definitions and list of pks (which
@@ -113,7 +413,13 @@ func (t *tokenized) fieldsAndTypes() ([]FieldDefinition, []FKDefinition, []strin
 		field := t.fields[i]
 		switch field.kind {
 		case SqlFK:
-			pk := field.references.primary()
+			if err := field.checkReferences(t.name); err != nil {
+				return nil, nil, nil, err
+			}
+			pk, err := field.references.primaryColumns()
+			if err != nil {
+				return nil, nil, nil, err
+			}
 			// FIXME: This "invents" an _ID fields which should be inserted
 			// automatically in create statements that dont find pks.
 			if len(pk) == 0 {
@@ -122,29 +428,37 @@ func (t *tokenized) fieldsAndTypes() ([]FieldDefinition, []FKDefinition, []strin
 						RemoteTable: field.references.name,
 						Names:       []string{field.name},
 						RemoteNames: []string{"_ID"},
+						OnDelete:    field.onDelete,
+						OnUpdate:    field.onUpdate,
 					})
 				partialFields = append(partialFields,
 					FieldDefinition{
-						Name: field.name,
-						Type: SqlInt,
+						Name:        field.name,
+						Type:        SqlInt,
+						Comment:     field.comment,
+						RenamedFrom: field.renamedFrom,
 					})
 
 				continue
 			}
 
 			fieldNames := make([]string, len(pk))
+			remoteNames := make([]string, len(pk))
 			for i := range pk {
-				pkName := pk[i]
-				name := fmt.Sprintf("%s_%s_fk", field.name, pkName)
-				fieldKind, ok := field.references.fieldKind(pkName)
-				if !ok {
-					return nil, nil, nil, fmt.Errorf("cannot determine the type for referenced pk %q in type %q", pkName, field.references.name)
-				}
+				name := fkColumnName(field.name, pk[i].name)
 				fieldNames[i] = name
+				remoteNames[i] = pk[i].name
+				var renamedFrom string
+				if field.renamedFrom != "" {
+					renamedFrom = fkColumnName(field.renamedFrom, pk[i].name)
+				}
 				partialFields = append(partialFields,
 					FieldDefinition{
-						Name: name,
-						Type: fieldKind,
+						Name:        name,
+						Type:        pk[i].kind,
+						Size:        pk[i].size,
+						Comment:     field.comment,
+						RenamedFrom: renamedFrom,
 					})
 
 			}
@@ -153,20 +467,282 @@ func (t *tokenized) fieldsAndTypes() ([]FieldDefinition, []FKDefinition, []strin
 				FKDefinition{
 					RemoteTable: field.references.name,
 					Names:       fieldNames,
-					RemoteNames: pk,
+					RemoteNames: remoteNames,
+					OnDelete:    field.onDelete,
+					OnUpdate:    field.onUpdate,
 				})
 
 			continue
 
+		case SqlHasMany, SqlManyToMany:
+			// held by the other type, see backRefs, or by a
+			// join table, see joinTableOf.
+			continue
+
 		default:
 			partialFields = append(partialFields,
 				FieldDefinition{
-					Name: field.name,
-					Type: field.kind,
+					Name:        field.name,
+					Type:        field.kind,
+					Size:        field.size,
+					Default:     field.defaultValue,
+					Check:       field.check,
+					Comment:     field.comment,
+					RenamedFrom: field.renamedFrom,
+					Nullable:    field.isNullable,
 				})
 		}
 	}
-	return partialFields, partialFKs, t.primary(), nil
+	for _, b := range t.backRefs {
+		pk, err := b.references.primaryColumns()
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		if len(pk) == 0 {
+			return nil, nil, nil, fmt.Errorf("%q has many %q but has %w to be referenced", b.references.name, t.name, ErrNoPrimaryKey)
+		}
+		fk := FKDefinition{
+			RemoteTable: b.references.name,
+			OnDelete:    FKCascade,
+			OnUpdate:    FKCascade,
+		}
+		for _, c := range pk {
+			name := fkColumnName(b.name, c.name)
+			fk.Names = append(fk.Names, name)
+			fk.RemoteNames = append(fk.RemoteNames, c.name)
+			partialFields = append(partialFields, FieldDefinition{Name: name, Type: c.kind, Size: c.size})
+		}
+		partialFKs = append(partialFKs, fk)
+	}
+	pks, err := t.primary()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return partialFields, partialFKs, pks, nil
+}
+
+// columnPaths returns, in the same order as the fields returned by
+// fieldsAndTypes, the names of the fields leading to the value of each
+// column or nil for the columns that are not held in the struct.
+func (t *tokenized) columnPaths() ([][]string, error) {
+	paths := [][]string{}
+	for _, field := range t.fields {
+		switch field.kind {
+		case SqlFK:
+			if err := field.checkReferences(t.name); err != nil {
+				return nil, err
+			}
+			pk, err := field.references.primaryColumns()
+			if err != nil {
+				return nil, err
+			}
+			if len(pk) == 0 {
+				paths = append(paths, nil)
+			}
+			for _, c := range pk {
+				paths = append(paths, append([]string{field.field}, c.path...))
+			}
+		case SqlHasMany, SqlManyToMany:
+		default:
+			paths = append(paths, []string{field.field})
+		}
+	}
+	for _, b := range t.backRefs {
+		pk, err := b.references.primaryColumns()
+		if err != nil {
+			return nil, err
+		}
+		for range pk {
+			paths = append(paths, nil)
+		}
+	}
+	return paths, nil
+}
+
+// hasMany returns the has many field with the passed name and a bool
+// indicating if it exists.
+func (t *tokenized) hasMany(name string) (tokenizedField, bool) {
+	for _, f := range t.fields {
+		if f.kind == SqlHasMany && f.field == name {
+			return f, true
+		}
+	}
+	return tokenizedField{}, false
+}
+
+// manyToMany returns the many to many field with the passed name and
+// a bool indicating if it exists.
+func (t *tokenized) manyToMany(name string) (tokenizedField, bool) {
+	for _, f := range t.fields {
+		if f.kind == SqlManyToMany && f.field == name {
+			return f, true
+		}
+	}
+	return tokenizedField{}, false
+}
+
+// joinTableOf returns the tokenized join table for the passed many to
+// many field of t, which is made of two Foreign Keys composing the
+// primary key, and the names of the fields holding each of them.
+func (t *tokenized) joinTableOf(f tokenizedField) (*tokenized, string, string) {
+	local, remote := t.name, f.many.name
+	// a type linked to itself needs a distinct name for each side.
+	if local == remote {
+		remote = f.name
+	}
+	join := &tokenized{
+		name: f.joinTable,
+		fields: []tokenizedField{
+			{name: local, kind: SqlFK, isPk: true, references: t, onDelete: FKCascade, onUpdate: FKCascade},
+			{name: remote, kind: SqlFK, isPk: true, references: f.many, onDelete: FKCascade, onUpdate: FKCascade},
+		},
+	}
+	return join, local, remote
+}
+
+// links returns the fields and values for each of the rows of the join
+// table linking the passed value of t with the elements of its many to
+// many field f.
+func (t *tokenized) links(f tokenizedField, v reflect.Value) ([]*FieldsWithValue, error) {
+	_, local, remote := t.joinTableOf(f)
+	if v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+	localValues, err := t.primaryFieldsAndValuess(local, v)
+	if err != nil {
+		return nil, err
+	}
+	links := []*FieldsWithValue{}
+	elems := v.FieldByName(f.field)
+	for i := 0; i < elems.Len(); i++ {
+		elem := elems.Index(i)
+		if elem.Kind() == reflect.Ptr {
+			if elem.IsNil() {
+				continue
+			}
+			elem = elem.Elem()
+		}
+		remoteValues, err := f.many.primaryFieldsAndValuess(remote, elem)
+		if err != nil {
+			return nil, err
+		}
+		link := NewFieldsWithValue()
+		if err := link.Append(localValues); err != nil {
+			return nil, err
+		}
+		if err := link.Append(remoteValues); err != nil {
+			return nil, err
+		}
+		links = append(links, link)
+	}
+	return links, nil
+}
+
+// columnNames returns the names of the columns that hold this field, Foreign
+// Keys to types with composite primary keys are held in many columns.
+func (f tokenizedField) columnNames() ([]string, error) {
+	if f.kind != SqlFK {
+		return []string{f.name}, nil
+	}
+	pk, err := f.references.primary()
+	if err != nil {
+		return nil, err
+	}
+	if len(pk) == 0 {
+		return []string{f.name}, nil
+	}
+	names := make([]string, len(pk))
+	for i := range pk {
+		names[i] = fkColumnName(f.name, pk[i])
+	}
+	return names, nil
+}
+
+// indexes returns the definitions of the indexes declared on the fields
+// for the passed table sorted by name, fields sharing an index name are
+// part of the same index in the order they are declared.
+func (t *tokenized) indexes(table string) ([]IndexDefinition, error) {
+	byName := map[string]*IndexDefinition{}
+	names := []string{}
+	for _, f := range t.fields {
+		for _, idx := range f.indexes {
+			name := idx.name
+			if name == "" {
+				prefix := "idx"
+				if idx.unique {
+					prefix = "uidx"
+				}
+				name = fmt.Sprintf("%s_%s_%s", prefix, table, f.name)
+			}
+			definition, ok := byName[name]
+			if !ok {
+				definition = &IndexDefinition{
+					Name:   name,
+					Table:  table,
+					Unique: idx.unique,
+				}
+				byName[name] = definition
+				names = append(names, name)
+			}
+			if definition.Unique != idx.unique {
+				return nil, fmt.Errorf("index %q is declared both unique and not unique", name)
+			}
+			columns, err := f.columnNames()
+			if err != nil {
+				return nil, err
+			}
+			definition.Columns = append(definition.Columns, columns...)
+		}
+	}
+	sort.Strings(names)
+	indexes := make([]IndexDefinition, len(names))
+	for i, name := range names {
+		indexes[i] = *byName[name]
+	}
+	return indexes, nil
+}
+
+// uniques returns a UNIQUE constraint definition for each field
+// tagged as unique.
+func (t *tokenized) uniques() ([]UniqueDefinition, error) {
+	uniques := []UniqueDefinition{}
+	for _, f := range t.fields {
+		if f.isUnique {
+			columns, err := f.columnNames()
+			if err != nil {
+				return nil, err
+			}
+			uniques = append(uniques, UniqueDefinition{Columns: columns})
+		}
+	}
+	return uniques, nil
+}
+
+// tableDefinition returns the definition of this tokenized type as the
+// passed table with the constraints named by namer.
+func (t *tokenized) tableDefinition(table string, namer ConstraintNamer) (TableDefinition, error) {
+	fields, fks, pks, err := t.fieldsAndTypes()
+	if err != nil {
+		return TableDefinition{}, err
+	}
+	uniques, err := t.uniques()
+	if err != nil {
+		return TableDefinition{}, err
+	}
+	indexes, err := t.indexes(table)
+	if err != nil {
+		return TableDefinition{}, err
+	}
+	definition := TableDefinition{
+		Name:    table,
+		Fields:  fields,
+		FKs:     fks,
+		PKs:     pks,
+		Uniques: uniques,
+		Indexes: indexes,
+	}
+	nameConstraints(&definition, namer)
+	return definition, nil
 }
 
 // primaryFieldsAndValuess returns two slices with the fields and values for primary keys
@@ -174,26 +750,59 @@ func (t *tokenized) fieldsAndTypes() ([]FieldDefinition, []FKDefinition, []strin
 // same.
 // TODO(perrito666) add a type check
 func (t *tokenized) primaryFieldsAndValuess(name string, remote reflect.Value) (*FieldsWithValue, error) {
-	pks := t.primary()
+	pks, err := t.primaryColumns()
+	if err != nil {
+		return nil, err
+	}
 	fields := NewFieldsWithValue()
 	for i := range pks {
 		current := pks[i]
 
-		value := remote.FieldByName(current)
+		value, ok := valueAt(remote, current.path)
+		if !ok {
+			return nil, fmt.Errorf("cannot determine primary key values, failed on %q", current.name)
+		}
 		s, ok := valueStringer(value)
 		if !ok {
-			return nil, fmt.Errorf("cannot determine primary key values, failed on %q", current)
+			return nil, fmt.Errorf("cannot determine primary key values, failed on %q", current.name)
 		}
 
-		fields.Add(FieldWithValue{
-			Name:  fmt.Sprintf("%s_%s_fk", name, current),
+		if err := fields.Add(FieldWithValue{
+			Name:  fkColumnName(name, current.name),
 			Value: s,
-		})
+		}); err != nil {
+			return nil, err
+		}
 	}
 	return fields, nil
 
 }
 
+// valueAt returns the value found by following the passed field names
+// from v, dereferencing pointers on the way, and a boolean indicating
+// if it was possible.
+func valueAt(v reflect.Value, path []string) (reflect.Value, bool) {
+	for _, name := range path {
+		if v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				return reflect.Value{}, false
+			}
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		v = v.FieldByName(name)
+	}
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+		v = v.Elem()
+	}
+	return v, v.IsValid()
+}
+
 // valueStringer tries to return a string representing the value
 // of the passed reflect.Value and a boolean indicating if it
 // was possible.
@@ -210,7 +819,7 @@ func valueStringer(value reflect.Value) (string, bool) {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
 		v := value.Int()
 		stringValue = fmt.Sprintf("%d", v)
-	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		v := value.Uint()
 		stringValue = fmt.Sprintf("%d", v)
 	case reflect.Float32, reflect.Float64:
@@ -218,6 +827,13 @@ func valueStringer(value reflect.Value) (string, bool) {
 		stringValue = fmt.Sprintf("%f", v)
 	case reflect.String:
 		stringValue = fmt.Sprintf("%q", value.String())
+	case reflect.Struct:
+		// the value of an unexported time.Time cannot be read.
+		if value.Type() != timeType || !value.CanInterface() {
+			return "", false
+		}
+		v := value.Interface().(time.Time)
+		stringValue = fmt.Sprintf("%q", v.Format(timestampLayout))
 	default:
 		return "", false
 	}
@@ -225,36 +841,148 @@ func valueStringer(value reflect.Value) (string, bool) {
 
 }
 
+// kindTypes holds a type for each of the kinds that can be
+// described by name in map based schemas.
+var kindTypes = map[reflect.Kind]reflect.Type{
+	reflect.Bool:    reflect.TypeOf(false),
+	reflect.Int:     reflect.TypeOf(int(0)),
+	reflect.Int8:    reflect.TypeOf(int8(0)),
+	reflect.Int16:   reflect.TypeOf(int16(0)),
+	reflect.Int32:   reflect.TypeOf(int32(0)),
+	reflect.Int64:   reflect.TypeOf(int64(0)),
+	reflect.Uint:    reflect.TypeOf(uint(0)),
+	reflect.Uint8:   reflect.TypeOf(uint8(0)),
+	reflect.Uint16:  reflect.TypeOf(uint16(0)),
+	reflect.Uint32:  reflect.TypeOf(uint32(0)),
+	reflect.Uint64:  reflect.TypeOf(uint64(0)),
+	reflect.Float32: reflect.TypeOf(float32(0)),
+	reflect.Float64: reflect.TypeOf(float64(0)),
+	reflect.String:  reflect.TypeOf(""),
+}
+
+// literal parses the passed raw string as a value of the given type and
+// renders it with the same escaping used for INSERT values.
+func literal(t reflect.Type, raw string) (string, error) {
+	v := reflect.New(t).Elem()
+	if err := parseInto(v, raw); err != nil {
+		return "", err
+	}
+	s, _ := valueStringer(v)
+	return s, nil
+}
+
+// parseInto parses the passed raw string as a value of the type of v
+// and sets v to it.
+func parseInto(v reflect.Value, raw string) error {
+	var err error
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Bool:
+		var b bool
+		b, err = strconv.ParseBool(raw)
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		i, err = strconv.ParseInt(raw, 10, t.Bits())
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(raw, 10, t.Bits())
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(raw, t.Bits())
+		v.SetFloat(f)
+	case reflect.String:
+		v.SetString(raw)
+	default:
+		if t != timeType {
+			return fmt.Errorf("cannot express literals of type %v", t)
+		}
+		var tm time.Time
+		tm, err = time.Parse(timestampLayout, raw)
+		v.Set(reflect.ValueOf(tm))
+	}
+	if err != nil {
+		return fmt.Errorf("parsing %q as %v: %w", raw, t, err)
+	}
+	return nil
+}
+
+// renderDefault replaces the raw default of the field, if any, with
+// its literal representation for the passed type.
+func (f *tokenizedField) renderDefault(t reflect.Type) error {
+	if f.defaultValue == "" {
+		return nil
+	}
+	if f.isNullable && f.defaultValue == sqlNull {
+		return nil
+	}
+	if f.kind == SqlFK {
+		return fmt.Errorf("foreign key field %q cannot have a default", f.name)
+	}
+	l, err := literal(t, f.defaultValue)
+	if err != nil {
+		return fmt.Errorf("rendering default for field %q: %w", f.name, err)
+	}
+	f.defaultValue = l
+	return nil
+}
+
 // fieldsAndValues returns two slices representing the fields in the passed interface
 // and its values, all in strings or errors if it was not possible to determine them.
 // The passed object should be of the same type as the tokenized.
 // TODO(perrito666) add a type check for the interface.
 func (t *tokenized) fieldsAndValues(in interface{}) (*FieldsWithValue, error) {
+	return t.valuesOf(reflect.ValueOf(in))
+}
+
+// valuesOf is fieldsAndValues for an already reflected value, pointers
+// are dereferenced.
+func (t *tokenized) valuesOf(concreteElem reflect.Value) (*FieldsWithValue, error) {
 	fields := NewFieldsWithValue()
-	concreteElem := reflect.ValueOf(in)
+	if concreteElem.Kind() == reflect.Ptr {
+		concreteElem = concreteElem.Elem()
+	}
 	for i := range t.fields {
 		current := t.fields[i]
-		value := concreteElem.FieldByName(current.name)
+		value := concreteElem.FieldByName(current.field)
 		if value.Kind() == reflect.Ptr {
+			if value.IsNil() && current.isNullable {
+				if err := fields.Add(FieldWithValue{
+					Name:  current.name,
+					Value: sqlNull,
+				}); err != nil {
+					return nil, err
+				}
+				continue
+			}
 			value = value.Elem()
 		}
 
-		if value.Kind() == reflect.Struct {
+		if current.kind == SqlFK && value.Kind() == reflect.Struct {
 			f, err := current.references.primaryFieldsAndValuess(current.name, value)
 			if err != nil {
-				return nil, fmt.Errorf("crafting foreign key: %v", err)
+				return nil, fmt.Errorf("crafting foreign key: %w", err)
+			}
+			if err := fields.Append(f); err != nil {
+				return nil, fmt.Errorf("crafting foreign key: %w", err)
 			}
-			fields.Append(f)
 			continue
 		}
 		stringValue, ok := valueStringer(value)
 		if !ok {
+			if value.IsValid() && value.Type() == timeType {
+				return nil, fmt.Errorf("cannot read the value of unexported field %q", current.name)
+			}
 			continue
 		}
-		fields.Add(FieldWithValue{
+		if err := fields.Add(FieldWithValue{
 			Name:  current.name,
 			Value: stringValue,
-		})
+		}); err != nil {
+			return nil, err
+		}
 
 	}
 	return fields, nil
@@ -267,9 +995,12 @@ func (t *tokenized) fieldsAndValues(in interface{}) (*FieldsWithValue, error) {
 func (t *tokenized) pksFieldsAndValues(in interface{}) (*FieldsWithValue, *FieldsWithValue, error) {
 	f, err := t.fieldsAndValues(in)
 	if err != nil {
-		return nil, nil, fmt.Errorf("determining fields and values: %v", err)
+		return nil, nil, fmt.Errorf("determining fields and values: %w", err)
+	}
+	pks, err := t.primary()
+	if err != nil {
+		return nil, nil, err
 	}
-	pks := t.primary()
 	p := NewFieldsWithValue()
 	for _, k := range pks {
 		pf, ok := f.Pop(k)
@@ -280,6 +1011,45 @@ func (t *tokenized) pksFieldsAndValues(in interface{}) (*FieldsWithValue, *Field
 	return p, f, nil
 }
 
+// lockVersion moves the version field, if any, from fields into conditions
+// with its current value and sets it in fields to the next one so the
+// resulting UPDATE only matches the row if nobody changed it meanwhile.
+func (t *tokenized) lockVersion(in interface{}, conditions, fields *FieldsWithValue) error {
+	v, ok := t.version()
+	if !ok {
+		return nil
+	}
+	current, ok := fields.Pop(v.name)
+	if !ok {
+		return fmt.Errorf("version field %q has no value", v.name)
+	}
+	var next string
+	concreteElem := reflect.ValueOf(in)
+	if concreteElem.Kind() == reflect.Ptr {
+		concreteElem = concreteElem.Elem()
+	}
+	value := concreteElem.FieldByName(v.field)
+	switch value.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		next = fmt.Sprintf("%d", value.Int()+1)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		next = fmt.Sprintf("%d", value.Uint()+1)
+	default:
+		return fmt.Errorf("version field %q is not an integer", v.name)
+	}
+	fields.Add(FieldWithValue{Name: v.name, Value: next})
+	return conditions.Add(current)
+}
+
+// resolveGoType is like resolveType but it also takes care of the
+// struct types that are not Foreign Keys, such as time.Time.
+func resolveGoType(t reflect.Type) (ANSISQLFieldKind, error) {
+	if t == timeType {
+		return SqlTimestamp, nil
+	}
+	return resolveType(t.Kind())
+}
+
 // resolveType tries to map the values on the struct
 // to valid ANSI SQL types, for now it is quite rudimentary
 // and arbitrary, it also asumes all pointers to be struct ptr.
@@ -290,9 +1060,11 @@ func resolveType(f reflect.Kind) (ANSISQLFieldKind, error) {
 		sqlType = SqlInt
 	case reflect.Int, reflect.Int8:
 		sqlType = SqlSmallInt
-	case reflect.Int16, reflect.Int32, reflect.Int64:
+	case reflect.Int32:
+		sqlType = SqlInt
+	case reflect.Int16, reflect.Int64:
 		sqlType = SqlBigInt
-	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		sqlType = SqlBigInt
 	case reflect.Float32:
 		sqlType = SqlFloat
@@ -303,7 +1075,7 @@ func resolveType(f reflect.Kind) (ANSISQLFieldKind, error) {
 	case reflect.Struct, reflect.Ptr:
 		sqlType = SqlFK
 	default:
-		return SqlInvalid, fmt.Errorf("Cannot convert %v to any valid SQL type", f)
+		return SqlInvalid, &ErrUnsupportedType{Kind: f}
 	}
 	return sqlType, nil
 }
@@ -311,22 +1083,117 @@ func resolveType(f reflect.Kind) (ANSISQLFieldKind, error) {
 const (
 	tagPrimary = "primary"
 	tagUnique  = "unique"
+	tagVersion = "version"
+
+	tagSoftDelete = "softdelete"
+	tagCreated    = "created"
+	tagUpdated    = "updated"
+
+	// tags that take a value in the form tag=value.
+	tagDefault = "default"
+	tagCheck   = "check"
+	tagComment = "comment"
+
+	tagRenamedFrom = "renamed_from"
+	tagSize        = "size"
+	tagColumn      = "column"
+
+	// index tags can also take a value, the name of the index.
+	tagIndex       = "index"
+	tagUniqueIndex = "uniqueindex"
+
+	tagOnDelete = "ondelete"
+	tagOnUpdate = "onupdate"
+
+	tagBackref = "backref"
+	tagM2M     = "m2m"
 )
 
+// isIntegerKind returns true if the passed kind is any of the
+// signed or unsigned integer kinds.
+func isIntegerKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return true
+	}
+	return false
+}
+
 // processTags is a convenience method that checks if
-// the passed tag has sql information.
-func (f *tokenizedField) processTags(tag reflect.StructTag) {
+// the passed tag has sql information and errors if it is invalid.
+// Values can't contain commas since those separate the tags.
+func (f *tokenizedField) processTags(tag reflect.StructTag) error {
 	tagstring := tag.Get("sql")
 	tags := strings.Split(tagstring, ",")
 	for _, t := range tags {
-		switch t {
-		case tagPrimary:
-			f.isPk = true
-		case tagUnique:
-			f.isUnique = true
+		var value string
+		if i := strings.Index(t, "="); i >= 0 {
+			t, value = t[:i], t[i+1:]
+		}
+		if err := f.setTag(t, value); err != nil {
+			return err
 		}
 	}
+	return nil
+}
 
+// setTag sets the passed tag, with its value if it takes one, on the
+// field, unknown tags are ignored.
+func (f *tokenizedField) setTag(t, value string) error {
+	switch t {
+	case tagPrimary:
+		f.isPk = true
+	case tagUnique:
+		f.isUnique = true
+	case tagVersion:
+		f.isVersion = true
+	case tagSoftDelete:
+		f.isSoftDelete = true
+	case tagCreated:
+		f.isCreated = true
+	case tagUpdated:
+		f.isUpdated = true
+	case tagDefault:
+		// rendered once the type of the field is known.
+		f.defaultValue = value
+	case tagCheck:
+		f.check = value
+	case tagComment:
+		f.comment = value
+	case tagRenamedFrom:
+		f.renamedFrom = value
+	case tagColumn:
+		if value == "" {
+			return fmt.Errorf("column name of field %q cannot be empty", f.name)
+		}
+		f.name = value
+	case tagSize:
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			return fmt.Errorf("size %q of field %q must be a positive integer", value, f.name)
+		}
+		f.size = size
+	case tagIndex:
+		f.indexes = append(f.indexes, fieldIndex{name: value})
+	case tagUniqueIndex:
+		f.indexes = append(f.indexes, fieldIndex{name: value, unique: true})
+	case tagBackref:
+		f.backref = value
+	case tagM2M:
+		f.joinTable = value
+	case tagOnDelete, tagOnUpdate:
+		action, ok := fkActions[value]
+		if !ok {
+			return fmt.Errorf("unknown referential action %q for field %q", value, f.name)
+		}
+		if t == tagOnDelete {
+			f.onDelete = action
+		} else {
+			f.onUpdate = action
+		}
+	}
+	return nil
 }
 
 // resolveKindByString receives a type in form of a string
@@ -377,62 +1244,330 @@ func resolveKindByString(typeof string) (reflect.Kind, error) {
 //         type: int
 //         unique: true
 //         primary: true
-//       created:
-//         type: float
+//       name:
+//         type: string
+//         size: 100
+//         nullable: true
+//       owner:
+//         references: owners.id
+//         ondelete: setnull
 //
+// Columns accept the tags, see processTags, as keys, size only for types
+// with a length or precision. Nullable columns accept NULL values, as
+// pointer fields do, this only changes how values are marshalled since
+// CREATE statements do not render NOT NULL for the rest. Foreign Keys are
+// declared with references, a table or a "table.column" where the column
+// is the primary key of the table, and have no type, they are resolved by
+// the Schema the table is registered in.
+// Maps have no order, columns are sorted by their order key, the ones
+// without it last, and then by name, see TokenizeMapSlice to keep the
+// order of a document instead.
 func TokenizeMap(t map[interface{}]interface{}, name string) (*tokenized, error) {
-	var fields []tokenizedField
-
+	columns := make([]mapColumn, 0, len(t))
 	for key, value := range t {
-		value := value.(map[interface{}]interface{})
-		kind, err := resolveKindByString(value["type"].(string))
+		column, err := newMapColumn(name, key, value)
 		if err != nil {
 			return nil, err
 		}
+		columns = append(columns, column)
+	}
+	sort.Slice(columns, func(i, j int) bool {
+		a, b := columns[i], columns[j]
+		if a.hasOrder != b.hasOrder {
+			return a.hasOrder
+		}
+		if a.order != b.order {
+			return a.order < b.order
+		}
+		return a.name < b.name
+	})
+	return tokenizeColumns(columns, name)
+}
 
-		sqlType, err := resolveType(kind)
+// MapSchemaError is returned for a malformed entry of a map based table,
+// Table, Field and Key are its path, Field and Key are empty if the entry
+// is the table or the field itself.
+type MapSchemaError struct {
+	Table string
+	Field string
+	Key   string
+	Err   error
+}
+
+// Error implements error.
+func (e *MapSchemaError) Error() string {
+	path := []string{e.Table}
+	for _, p := range []string{e.Field, e.Key} {
+		if p != "" {
+			path = append(path, p)
+		}
+	}
+	return fmt.Sprintf("%s: %v", strings.Join(path, "."), e.Err)
+}
+
+// Unwrap returns the problem with the entry.
+func (e *MapSchemaError) Unwrap() error {
+	return e.Err
+}
+
+// mapOrder is the key holding the position of a column in a map.
+const mapOrder = "order"
+
+// mapColumn is the name of a column declared in a map and the keys
+// that describe it.
+type mapColumn struct {
+	name     string
+	values   map[interface{}]interface{}
+	order    int
+	hasOrder bool
+}
+
+// newMapColumn returns the column of table declared with the passed key
+// and value, which must be a map.
+func newMapColumn(table string, key, value interface{}) (mapColumn, error) {
+	column := mapColumn{name: fmt.Sprint(key)}
+	values, ok := mapValues(value)
+	if !ok {
+		return column, &MapSchemaError{Table: table, Field: column.name, Err: fmt.Errorf("must be a map, got %T", value)}
+	}
+	column.values = values
+	if order, ok := values[mapOrder]; ok {
+		if column.order, ok = intValue(order); !ok {
+			return column, &MapSchemaError{Table: table, Field: column.name, Key: mapOrder, Err: fmt.Errorf("must be an integer, got %v", order)}
+		}
+		column.hasOrder = true
+	}
+	return column, nil
+}
+
+// intValue returns the passed number as an int and a bool indicating if
+// it is an integer, decoders produce different types for them.
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case int:
+		return n, true
+	case int64:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	case float64:
+		return int(n), n == float64(int(n))
+	}
+	return 0, false
+}
+
+// boolKey returns the bool under the passed key, false if it is missing.
+func (c mapColumn) boolKey(key string) (bool, error) {
+	v, ok := c.values[key]
+	if !ok {
+		return false, nil
+	}
+	b, ok := v.(bool)
+	if !ok {
+		return false, fmt.Errorf("must be a bool, got %v", v)
+	}
+	return b, nil
+}
+
+// stringKey returns the scalar under the passed key as a string and a
+// bool indicating if it is present.
+func (c mapColumn) stringKey(key string) (string, bool, error) {
+	v, ok := c.values[key]
+	if !ok {
+		return "", false, nil
+	}
+	switch v.(type) {
+	case string, bool, int, int64, uint64, float64:
+		return fmt.Sprint(v), true, nil
+	}
+	return "", false, fmt.Errorf("must be a scalar, got %T", v)
+}
+
+// tokenizeColumns returns a new tokenized struct with the passed columns,
+// in the same order, see TokenizeMap.
+func tokenizeColumns(columns []mapColumn, name string) (*tokenized, error) {
+	var fields []tokenizedField
+
+	for _, column := range columns {
+		field, key, err := column.field()
 		if err != nil {
-			return nil, err
+			return nil, &MapSchemaError{Table: name, Field: column.name, Key: key, Err: err}
 		}
+		fields = append(fields, field)
+	}
+
+	return &tokenized{fields: fields, name: name}, nil
+}
 
-		field := tokenizedField{
-			name:   key.(string),
-			goType: kind,
-			kind:   sqlType,
+// field returns the tokenized field for this column or the key that is
+// malformed and why.
+func (c mapColumn) field() (tokenizedField, string, error) {
+	field := tokenizedField{
+		name:     c.name,
+		onDelete: FKCascade,
+		onUpdate: FKCascade,
+	}
+
+	flags := []struct {
+		key   string
+		value *bool
+	}{
+		{"nullable", &field.isNullable},
+		{tagPrimary, &field.isPk},
+		{tagUnique, &field.isUnique},
+		{tagVersion, &field.isVersion},
+	}
+	for _, flag := range flags {
+		var err error
+		if *flag.value, err = c.boolKey(flag.key); err != nil {
+			return field, flag.key, err
 		}
+	}
 
-		if primary, ok := value["primary"]; ok && primary.(bool) {
-			field.isPk = true
-		} else {
-			field.isPk = false
+	references, ok, err := c.stringKey("references")
+	if err != nil {
+		return field, "references", err
+	}
+	if ok {
+		field.referencesName = references
+		field.goType = reflect.Ptr
+		field.kind = SqlFK
+	} else {
+		typeof, ok, err := c.stringKey("type")
+		if err != nil {
+			return field, "type", err
+		}
+		if !ok {
+			return field, "type", fmt.Errorf("is missing, columns need a type or references")
+		}
+		kind, err := resolveKindByString(typeof)
+		if err != nil {
+			return field, "type", err
 		}
 
-		if unique, ok := value["unique"]; ok && unique.(bool) {
-			field.isUnique = true
-		} else {
-			field.isUnique = false
+		sqlType, err := resolveType(kind)
+		if err != nil {
+			return field, "type", err
 		}
+		field.goType = kind
+		field.kind = sqlType
+	}
 
-		fields = append(fields, field)
+	if field.isVersion && !isIntegerKind(field.goType) {
+		return field, tagVersion, fmt.Errorf("version field %q must be an integer, got %v", field.name, field.goType)
 	}
 
-	return &tokenized{fields: fields, name: name}, nil
+	for _, tag := range []string{tagCheck, tagComment, tagRenamedFrom, tagSize, tagOnDelete, tagOnUpdate} {
+		value, ok, err := c.stringKey(tag)
+		if err != nil {
+			return field, tag, err
+		}
+		if !ok {
+			continue
+		}
+		if err := field.setTag(tag, value); err != nil {
+			return field, tag, err
+		}
+	}
+	if field.size > 0 && !sizedKinds[field.kind] {
+		return field, tagSize, fmt.Errorf("only character strings and numbers can have a size")
+	}
+	for _, tag := range []string{tagIndex, tagUniqueIndex} {
+		switch index := c.values[tag].(type) {
+		case nil:
+		case bool:
+			if index {
+				field.indexes = append(field.indexes, fieldIndex{unique: tag == tagUniqueIndex})
+			}
+		case string:
+			field.indexes = append(field.indexes, fieldIndex{name: index, unique: tag == tagUniqueIndex})
+		default:
+			return field, tag, fmt.Errorf("must be a bool or the name of the index, got %v", index)
+		}
+	}
+	if !field.isNullable && (field.onDelete == FKSetNull || field.onUpdate == FKSetNull) {
+		return field, "nullable", fmt.Errorf("foreign key field %q must be nullable to be set to NULL", field.name)
+	}
+	def, ok, err := c.stringKey(tagDefault)
+	if err != nil {
+		return field, tagDefault, err
+	}
+	if ok {
+		field.defaultValue = def
+		if err := field.renderDefault(kindTypes[field.goType]); err != nil {
+			return field, tagDefault, err
+		}
+	}
+	return field, "", nil
 }
 
 // TokenizeType returns a new tokenized struct containing the
 // passed struct fields and their sql types.
 func TokenizeType(t reflect.Type, name string) (*tokenized, error) {
+	return tokenizeType(t, name, map[reflect.Type]*tokenized{})
+}
+
+// tokenizeType is TokenizeType using the passed cache for the referenced
+// types, this allows self referencing and cyclic Foreign Keys since
+// every type is tokenized only once.
+func tokenizeType(t reflect.Type, name string, cache map[reflect.Type]*tokenized) (*tokenized, error) {
+	result := &tokenized{name: name}
+	cache[t] = result
 	fieldCount := t.NumField()
 	fields := make([]tokenizedField, fieldCount)
 	for i := 0; i < fieldCount; i++ {
 		f := t.Field(i)
-		fields[i].name = f.Name
-		fields[i].goType = f.Type.Kind()
-		sqlType, err := resolveType(fields[i].goType)
-		if err != nil {
+		fields[i].name, fields[i].field = f.Name, f.Name
+		columnType := f.Type
+		// pointers to anything but a Foreign Key are nullable columns.
+		if columnType.Kind() == reflect.Ptr {
+			if elem := columnType.Elem(); elem.Kind() != reflect.Struct || elem == timeType {
+				fields[i].isNullable = true
+				columnType = elem
+			}
+		}
+		fields[i].goType = columnType.Kind()
+		var sqlType ANSISQLFieldKind
+		var err error
+		if elem, ptr, ok := hasManyElem(columnType); ok {
+			sqlType = SqlHasMany
+			fields[i].elemType, fields[i].ptrElem = elem, ptr
+		} else {
+			sqlType, err = resolveGoType(columnType)
+			var typeErr *ErrUnsupportedType
+			if errors.As(err, &typeErr) {
+				typeErr.Field = f.Name
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+		fields[i].onDelete, fields[i].onUpdate = FKCascade, FKCascade
+		if err := fields[i].processTags(f.Tag); err != nil {
+			return nil, err
+		}
+		if sqlType == SqlHasMany && fields[i].joinTable != "" {
+			sqlType = SqlManyToMany
+		}
+		if fields[i].isVersion && !isIntegerKind(fields[i].goType) {
+			return nil, fmt.Errorf("version field %q must be an integer, got %v", f.Name, fields[i].goType)
+		}
+		if fields[i].isSoftDelete {
+			nullableTimestamp := sqlType == SqlTimestamp && fields[i].isNullable
+			if !nullableTimestamp && fields[i].goType != reflect.Bool {
+				return nil, fmt.Errorf("soft delete field %q must be a bool or a nullable timestamp", f.Name)
+			}
+		}
+		if (fields[i].isCreated || fields[i].isUpdated) && sqlType != SqlTimestamp {
+			return nil, fmt.Errorf("created and updated field %q must be a timestamp", f.Name)
+		}
+		fields[i].kind = sqlType
+		if fields[i].size > 0 && !sizedKinds[sqlType] {
+			return nil, fmt.Errorf("field %q of type %s cannot have a size", f.Name, ansiTypes[sqlType])
+		}
+		if err := fields[i].renderDefault(columnType); err != nil {
 			return nil, err
 		}
-		fields[i].processTags(f.Tag)
 		if sqlType == SqlFK {
 			fieldType := f.Type
 			// if it is a ptr we need it dereferenced.
@@ -442,13 +1577,56 @@ func TokenizeType(t reflect.Type, name string) (*tokenized, error) {
 			if fieldType.Kind() != reflect.Struct {
 				return nil, fmt.Errorf("expected %v got %v", reflect.Struct, fieldType.Kind())
 			}
-			fk, err := TokenizeType(fieldType, fieldType.Name())
-			if err != nil {
-				return nil, fmt.Errorf("resolving foreign key for field %q: %v", f.Name, err)
+			nullable := f.Type.Kind() == reflect.Ptr
+			if !nullable && (fields[i].onDelete == FKSetNull || fields[i].onUpdate == FKSetNull) {
+				return nil, fmt.Errorf("foreign key field %q must be a pointer to be set to NULL", f.Name)
+			}
+			fk, ok := cache[fieldType]
+			if !ok {
+				fk, err = tokenizeType(fieldType, fieldType.Name(), cache)
+				if err != nil {
+					return nil, fmt.Errorf("resolving foreign key for field %q: %w", f.Name, err)
+				}
 			}
 			fields[i].references = fk
 		}
-		fields[i].kind = sqlType
+		if sqlType == SqlHasMany || sqlType == SqlManyToMany {
+			elem := fields[i].elemType
+			many, ok := cache[elem]
+			if !ok {
+				many, err = tokenizeType(elem, elem.Name(), cache)
+				if err != nil {
+					return nil, fmt.Errorf("resolving has many for field %q: %w", f.Name, err)
+				}
+			}
+			fields[i].many = many
+			if sqlType == SqlManyToMany {
+				continue
+			}
+			if fields[i].backref == "" {
+				fields[i].backref = name
+			}
+			many.backRefs = append(many.backRefs, backReference{name: fields[i].backref, references: result})
+		}
 	}
-	return &tokenized{fields: fields, name: name}, nil
+	result.fields = fields
+	return result, nil
+}
+
+// hasManyElem returns the element struct type of t if it is a slice of
+// structs or pointers to them, and thus a has many relation, along with
+// a bool indicating if the elements are pointers and another one that
+// is true only for has many relations.
+func hasManyElem(t reflect.Type) (reflect.Type, bool, bool) {
+	if t.Kind() != reflect.Slice {
+		return nil, false, false
+	}
+	elem, ptr := t.Elem(), false
+	if elem.Kind() == reflect.Ptr {
+		elem, ptr = elem.Elem(), true
+	}
+	if elem.Kind() != reflect.Struct || elem == timeType {
+		return nil, false, false
+	}
+	return elem, ptr, true
 }
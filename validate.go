@@ -0,0 +1,177 @@
+// Copyright 2016 Horacio Duran.
+// Licenced under the MIT licence, see LICENCE for details.
+package sqlmarshal
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError holds all the problems found validating the tables
+// of a marshaller or a schema.
+type ValidationError struct {
+	Problems []error
+}
+
+// Error implements error.
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Problems))
+	for i := range e.Problems {
+		problems[i] = e.Problems[i].Error()
+	}
+	return fmt.Sprintf("invalid schema: %s", strings.Join(problems, "; "))
+}
+
+// Unwrap returns the problems so errors.Is and errors.As look into them.
+func (e *ValidationError) Unwrap() []error {
+	return e.Problems
+}
+
+// validationError returns a *ValidationError for the passed problems or
+// nil if there are none.
+func validationError(problems []error) error {
+	if len(problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: problems}
+}
+
+// validateTable returns the problems of the passed table on its own, that
+// is repeated column names, including the ones held by Foreign Keys, types
+// the driver cannot define, identifiers that are reserved words and
+// constraints or indexes sharing a name once truncated for the driver.
+func validateTable(d SQLDriver, table TableDefinition) []error {
+	problems := []error{}
+	if d.IsReserved(table.Name) {
+		problems = append(problems, fmt.Errorf("table %q: name is a reserved word", table.Name))
+	}
+	// unquoted identifiers are case insensitive.
+	seen := map[string]bool{}
+	for _, f := range table.Fields {
+		if seen[strings.ToLower(f.Name)] {
+			problems = append(problems, fmt.Errorf("table %q: %w %q", table.Name, ErrDuplicateField, f.Name))
+		}
+		seen[strings.ToLower(f.Name)] = true
+		if _, ok := d.Define(f.Type, f.Name); !ok {
+			problems = append(problems, fmt.Errorf("table %q: the driver cannot define the type of column %q", table.Name, f.Name))
+		}
+		if d.IsReserved(f.Name) {
+			problems = append(problems, fmt.Errorf("table %q: column %q is a reserved word", table.Name, f.Name))
+		}
+	}
+	seen = map[string]bool{}
+	for _, name := range constraintNames(table) {
+		name = truncateIdentifier(name, d.MaxIdentifierLength())
+		if seen[strings.ToLower(name)] {
+			problems = append(problems, fmt.Errorf("table %q: constraint name %q is used more than once", table.Name, name))
+		}
+		seen[strings.ToLower(name)] = true
+	}
+	return problems
+}
+
+// constraintNames returns the names of the constraints and indexes of the
+// passed table, unnamed ones are left out.
+func constraintNames(table TableDefinition) []string {
+	names := []string{table.PKName}
+	for _, fk := range table.FKs {
+		names = append(names, fk.Name)
+	}
+	for _, u := range table.Uniques {
+		names = append(names, u.Name)
+	}
+	for _, f := range table.Fields {
+		names = append(names, f.CheckName)
+	}
+	for _, index := range table.Indexes {
+		names = append(names, index.Name)
+	}
+	named := []string{}
+	for _, name := range names {
+		if name != "" {
+			named = append(named, name)
+		}
+	}
+	return named
+}
+
+// validateTables returns the problems of each of the passed tables plus
+// those of their Foreign Keys, which must reference existing columns of
+// the same type in one of the tables.
+func validateTables(d SQLDriver, tables []TableDefinition) []error {
+	problems := []error{}
+	byName := map[string]TableDefinition{}
+	for _, table := range tables {
+		if _, ok := byName[table.Name]; ok {
+			problems = append(problems, fmt.Errorf("table %q: defined more than once", table.Name))
+		}
+		byName[table.Name] = table
+	}
+	for _, table := range tables {
+		problems = append(problems, validateTable(d, table)...)
+		for _, fk := range table.FKs {
+			remote, ok := byName[fk.RemoteTable]
+			if !ok {
+				problems = append(problems, fmt.Errorf("table %q: foreign key %v references table %q which is not in the schema", table.Name, fk.Names, fk.RemoteTable))
+				continue
+			}
+			for i := range fk.Names {
+				local, _ := columnType(table, fk.Names[i])
+				kind, ok := columnType(remote, fk.RemoteNames[i])
+				if !ok {
+					problems = append(problems, fmt.Errorf("table %q: foreign key %v references column %q which is not in table %q", table.Name, fk.Names, fk.RemoteNames[i], remote.Name))
+					continue
+				}
+				if local != kind {
+					problems = append(problems, fmt.Errorf("table %q: column %q does not have the type of the column %q it references in table %q", table.Name, fk.Names[i], fk.RemoteNames[i], remote.Name))
+				}
+			}
+		}
+	}
+	return problems
+}
+
+// columnType returns the type of the passed column of table and a bool
+// indicating if it exists.
+func columnType(table TableDefinition, column string) (ANSISQLFieldKind, bool) {
+	for _, f := range table.Fields {
+		if f.Name == column {
+			return f.Type, true
+		}
+	}
+	return SqlInvalid, false
+}
+
+// Validate returns a *ValidationError holding all the problems of the table
+// of this marshaller for the passed driver, Foreign Keys are not checked
+// since the tables they reference are not known, see Schema.Validate.
+func (s *SQLMarshaller) Validate(driver SQLDriver) error {
+	table, err := s.tokenized.tableDefinition(s.Name(), s.namer)
+	if err != nil {
+		return validationError([]error{fmt.Errorf("table %q: %w", s.Name(), err)})
+	}
+	return validationError(validateTable(driver, table))
+}
+
+// Validate returns a *ValidationError holding all the problems of the
+// registered tables and their join tables for the passed driver, including
+// Foreign Keys to tables that are not registered or of a different type
+// than the column they reference.
+func (s *Schema) Validate(driver SQLDriver) error {
+	problems := []error{}
+	tables := []TableDefinition{}
+	for _, m := range s.tables {
+		table, err := m.tokenized.tableDefinition(m.Name(), s.namer)
+		if err != nil {
+			problems = append(problems, fmt.Errorf("table %q: %w", m.Name(), err))
+			continue
+		}
+		tables = append(tables, table)
+	}
+	joins, err := s.joinTables(s.tables)
+	if err != nil {
+		problems = append(problems, err)
+	}
+	tables = append(tables, joins...)
+	return validationError(append(problems, validateTables(driver, tables)...))
+}